@@ -2,12 +2,17 @@ package fio
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
+	"github.com/fioprotocol/fio-go/eos/btcsuite/btcutil"
 	"github.com/fioprotocol/fio-go/eos/ecc"
 	"github.com/mr-tron/base58"
+	"io"
 	"io/ioutil"
+	"strings"
 )
 
 // Account holds the information for an account, it differs from a regular EOS account in that the
@@ -30,6 +35,9 @@ func (n Name) ToEos() eos.Name {
 // NewAccountFromWif builds an Account given a private key string.
 // Note: this is an ephemeral, in-memory, account which has no relation to keosd, and is not persistent.
 func NewAccountFromWif(wif string) (*Account, error) {
+	if err := ValidateWif(wif); err != nil {
+		return nil, err
+	}
 	kb := eos.NewKeyBag()
 	err := kb.ImportPrivateKey(wif)
 	if err != nil {
@@ -71,6 +79,121 @@ func NewRandomAccount() (*Account, error) {
 	return NewAccountFromWif(key.String())
 }
 
+// NewRandomAccountSeeded creates an account using 32 bytes read from r as the private key. It is intended for tests
+// that need to reproduce keys, such as seeding r with math/rand, and must not be used to generate production keys
+// unless r is a cryptographically secure source.
+func NewRandomAccountSeeded(r io.Reader) (*Account, error) {
+	key, err := ecc.NewDeterministicPrivateKey(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewAccountFromWif(key.String())
+}
+
+// NewAccountFromSeed deterministically derives an account from the sha256 hash of seed, the same seed always gives
+// the same key. This is for tests only: a key is only as strong as the seed, so do not use it for production keys.
+func NewAccountFromSeed(seed []byte) (*Account, error) {
+	if len(seed) == 0 {
+		return nil, errors.New("empty seed")
+	}
+	h := sha256.Sum256(seed)
+	return NewRandomAccountSeeded(bytes.NewReader(h[:]))
+}
+
+// ValidateWif checks that a private key is a correctly encoded WIF, with or without the PVT_K1_ prefix, so that user
+// supplied keys can be checked before building an Account.
+func ValidateWif(wif string) error {
+	wif = strings.TrimSpace(wif)
+	if wif == "" {
+		return errors.New("private key is empty")
+	}
+	if strings.HasPrefix(wif, ecc.PrivateKeyPrefix) {
+		if !strings.HasPrefix(wif, ecc.PrivateKeyPrefix+"K1_") {
+			return errors.New("only K1 private keys are supported")
+		}
+		wif = strings.TrimPrefix(wif, ecc.PrivateKeyPrefix+"K1_")
+	}
+	if _, err := btcutil.DecodeWIF(wif); err != nil {
+		switch err {
+		case btcutil.ErrChecksumMismatch:
+			return errors.New("private key checksum is incorrect, check for a typo")
+		case btcutil.ErrMalformedPrivateKey:
+			return errors.New("private key is not the correct length")
+		}
+		return fmt.Errorf("invalid private key: %v", err)
+	}
+	return nil
+}
+
+// ValidatePubKey checks that a public key has a FIO or EOS prefix and a valid checksum
+func ValidatePubKey(pub string) error {
+	_, err := normalizePubKey(pub)
+	return err
+}
+
+// normalizePubKey validates a FIO or EOS prefixed public key, and returns it with the FIO prefix
+func normalizePubKey(pubKey string) (string, error) {
+	switch {
+	case strings.HasPrefix(pubKey, "FIO"):
+	case strings.HasPrefix(pubKey, "EOS"):
+		// the legacy format checksum does not cover the prefix, so swapping it is safe
+		pubKey = "FIO" + pubKey[3:]
+	default:
+		return "", errors.New("public key should start with FIO or EOS")
+	}
+	p, err := ecc.NewPublicKey(pubKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %v", err)
+	}
+	return p.String(), nil
+}
+
+// SignMessage signs the sha256 hash of msg with the account's first key, returning a SIG_K1_ formatted signature.
+// This is meant for off-chain authentication, such as signing a nonce issued by a server.
+func (a *Account) SignMessage(msg []byte) (string, error) {
+	if a == nil || a.KeyBag == nil || len(a.KeyBag.Keys) == 0 {
+		return "", errors.New("account does not have a private key")
+	}
+	h := sha256.Sum256(msg)
+	sig, err := a.KeyBag.Keys[0].Sign(h[:])
+	if err != nil {
+		return "", err
+	}
+	return sig.String(), nil
+}
+
+// VerifyMessage checks a signature created by SignMessage. A signature by another key returns false, an error is
+// only returned for a malformed key or signature. The public key may have a FIO or EOS prefix.
+func VerifyMessage(pubKey string, msg []byte, sig string) (bool, error) {
+	fioPub, err := normalizePubKey(pubKey)
+	if err != nil {
+		return false, err
+	}
+	pub, err := ecc.NewPublicKey(fioPub)
+	if err != nil {
+		return false, err
+	}
+	signature, err := ecc.NewSignature(sig)
+	if err != nil {
+		return false, err
+	}
+	h := sha256.Sum256(msg)
+	return signature.Verify(h[:], pub), nil
+}
+
+// ActorFromPubKey is the same as ActorFromPub, but also accepts a legacy EOS prefixed key, for example when the
+// key was resolved from a contact's address mapping.
+func ActorFromPubKey(pubKey string) (eos.AccountName, error) {
+	if strings.HasPrefix(pubKey, "EOS") {
+		fioKey, err := normalizePubKey(pubKey)
+		if err != nil {
+			return "", err
+		}
+		pubKey = fioKey
+	}
+	return ActorFromPub(pubKey)
+}
+
 // ActorFromPub calculates the FIO Actor (EOS Account) from a public key
 func ActorFromPub(pubKey string) (eos.AccountName, error) {
 	// ensure the key is valid base58, and the 160 checksum is correct before encoding
@@ -161,8 +284,24 @@ type KeyWeight struct {
 	Weight    uint16         `json:"weight"` // weight_type
 }
 
+// GetAccount gets an account's permissions and resource usage, replacing the eos-go GetAccount which can't parse FIO
+// public keys. ErrAccountNotFound is returned if the account does not exist.
+func (api *API) GetAccount(name eos.AccountName) (*AccountResp, error) {
+	accResp := &AccountResp{}
+	err := api.call("chain", "get_account", map[string]string{"account_name": string(name)}, accResp)
+	if err == eos.ErrNotFound {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return accResp, nil
+}
+
 // GetFioAccount gets information about an account, it should be used instead of GetAccount due to differences in
 // public key formatting in eos vs fio packages.
+//
+// Deprecated: use GetAccount, which also reports errors and missing accounts.
 func (api *API) GetFioAccount(actor string) (*AccountResp, error) {
 	q := bytes.NewReader([]byte(`{"account_name": "` + actor + `"}`))
 	resp, err := api.HttpClient.Post(api.BaseURL+"/v1/chain/get_account", "application/json", q)
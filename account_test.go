@@ -1,10 +1,18 @@
 package fio
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func newApi() (*Account, *API, *TxOptions, error) {
@@ -15,6 +23,31 @@ func newApi() (*Account, *API, *TxOptions, error) {
 	return NewWifConnect("5JBbUG5SDpLWxvBKihMeXLENinUzdNKNeozLas23Mj6ZNhz3hLS", nodeos)
 }
 
+// newMockApi connects to a local test server, get_info is answered automatically with an irreversible block that
+// increments on each call, all other requests are passed to handler.
+func newMockApi(handler http.HandlerFunc) (*Account, *API, *httptest.Server, error) {
+	var lib uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/chain/get_info" {
+			lib := atomic.AddUint32(&lib, 1)
+			_, _ = fmt.Fprintf(w, `{"chain_id":"%s","head_block_num":%d,"last_irreversible_block_num":%d,"head_block_id":"%064x","head_block_time":"%s"}`,
+				ChainIdTestnet, lib+1, lib, lib+1, time.Now().UTC().Format("2006-01-02T15:04:05"))
+			return
+		}
+		handler(w, r)
+	}))
+	acc, err := NewRandomAccount()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	api, _, err := NewConnection(acc.KeyBag, srv.URL)
+	if err != nil {
+		srv.Close()
+		return nil, nil, nil, err
+	}
+	return acc, api, srv, nil
+}
+
 func TestAPI_GetFioAccount(t *testing.T) {
 	_, api, _, err := newApi()
 	if err != nil {
@@ -106,4 +139,174 @@ func TestActorFromPub(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestActorFromPubKey(t *testing.T) {
+	for _, pub := range []string{
+		"FIO586ZYe3CA2D3cpuYJk565Ny7RhgWxCwnX7kojZSaun2RbTocAf",
+		"EOS586ZYe3CA2D3cpuYJk565Ny7RhgWxCwnX7kojZSaun2RbTocAf",
+	} {
+		actor, err := ActorFromPubKey(pub)
+		if err != nil {
+			t.Fatal(pub, err)
+		}
+		if actor != "y5x3sk44d43p" {
+			t.Error(pub, "should map to y5x3sk44d43p, got", actor)
+		}
+	}
+	for _, pub := range []string{"EOS586ZYe3CA2D3cpuYJk565Ny7RhgWxCwnX7kojZSaun2RbTocA1", "EOS", ""} {
+		if actor, err := ActorFromPubKey(pub); err == nil || actor != "" {
+			t.Error(pub, "should be an invalid public key")
+		}
+	}
+}
+
+func TestNewAccountFromSeed(t *testing.T) {
+	a, err := NewAccountFromSeed([]byte("replayable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewAccountFromSeed([]byte("replayable"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewAccountFromSeed([]byte("different"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.PubKey != b.PubKey || a.Actor != b.Actor {
+		t.Error("the same seed should give the same account")
+	}
+	if a.PubKey == c.PubKey {
+		t.Error("different seeds should give different accounts")
+	}
+	if _, err = NewAccountFromSeed(nil); err == nil {
+		t.Error("expected an error for an empty seed")
+	}
+
+	x, _ := NewRandomAccountSeeded(rand.New(rand.NewSource(42)))
+	y, _ := NewRandomAccountSeeded(rand.New(rand.NewSource(42)))
+	if x == nil || y == nil || x.PubKey != y.PubKey {
+		t.Error("the same reader seed should give the same account")
+	}
+	if _, err = NewRandomAccountSeeded(bytes.NewReader(make([]byte, 8))); err == nil {
+		t.Error("expected an error for a short reader")
+	}
+}
+
+func TestAccount_SignMessage(t *testing.T) {
+	alice, _ := NewAccountFromSeed([]byte("alice"))
+	bob, _ := NewAccountFromSeed([]byte("bob"))
+	nonce := []byte("sign in with FIO: 8f2c1e")
+
+	sig, err := alice.SignMessage(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sig, "SIG_K1_") {
+		t.Errorf("unexpected signature format %s", sig)
+	}
+	if ok, err := VerifyMessage(alice.PubKey, nonce, sig); err != nil || !ok {
+		t.Errorf("signature should verify: %v", err)
+	}
+	if ok, err := VerifyMessage("EOS"+alice.PubKey[3:], nonce, sig); err != nil || !ok {
+		t.Errorf("EOS prefixed key should verify: %v", err)
+	}
+	if ok, _ := VerifyMessage(bob.PubKey, nonce, sig); ok {
+		t.Error("signature should not verify for another key")
+	}
+	if ok, _ := VerifyMessage(alice.PubKey, []byte("tampered"), sig); ok {
+		t.Error("signature should not verify for another message")
+	}
+	if _, err = VerifyMessage(alice.PubKey, nonce, "SIG_K1_invalid"); err == nil {
+		t.Error("expected an error for a malformed signature")
+	}
+	if _, err = (&Account{}).SignMessage(nonce); err == nil {
+		t.Error("expected an error for an account without a key")
+	}
+}
+
+func TestValidateWif_PubKey(t *testing.T) {
+	const wif = "5JfNfukKhyCe4MSTBMiMdT77d8MCetEpceDQqRh4DuJQ1CAEdQF"
+	for _, good := range []string{wif, "PVT_K1_" + wif, " " + wif + "\n"} {
+		if err := ValidateWif(good); err != nil {
+			t.Errorf("%q should be valid: %v", good, err)
+		}
+	}
+	for bad, want := range map[string]string{
+		"":                         "empty",
+		"PVT_R1_" + wif:            "only K1",
+		"PVT_":                     "only K1",
+		wif[:len(wif)-1] + "G":     "checksum",
+		"5JfNfukKhyCe4MSTBMiMdT77": "length",
+	} {
+		err := ValidateWif(bad)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", bad, want, err)
+		}
+	}
+	if _, err := NewAccountFromWif("PVT_"); err == nil {
+		t.Error("NewAccountFromWif should reject a malformed key")
+	}
+
+	const pub = "FIO6JN7BrPKPM8BqPs9zSPwbK3nWJ4EKvpjb4k9CFBQ6BbtrL2AHV"
+	for _, good := range []string{pub, "EOS" + pub[3:]} {
+		if err := ValidatePubKey(good); err != nil {
+			t.Errorf("%q should be valid: %v", good, err)
+		}
+	}
+	for _, bad := range []string{"", "FIO", "PUB_K1_" + pub[3:], pub[:len(pub)-1] + "W", "XYZ" + pub[3:]} {
+		if err := ValidatePubKey(bad); err == nil {
+			t.Errorf("%q should be invalid", bad)
+		}
+	}
+}
+
+func TestAPI_GetAccount(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_account" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := make(map[string]string)
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch req["account_name"] {
+		case "y5x3sk44d43p":
+			_, _ = w.Write([]byte(`{"account_name":"y5x3sk44d43p","privileged":false,"ram_quota":5350,"ram_usage":3210,
+				"net_limit":{"used":100,"available":900,"max":1000},"cpu_limit":{"used":200,"available":800,"max":1000},
+				"permissions":[
+					{"perm_name":"active","parent":"owner","required_auth":{"threshold":1,"keys":[{"key":"FIO586ZYe3CA2D3cpuYJk565Ny7RhgWxCwnX7kojZSaun2RbTocAf","weight":1}],"accounts":[],"waits":[]}},
+					{"perm_name":"owner","parent":"","required_auth":{"threshold":1,"keys":[{"key":"FIO586ZYe3CA2D3cpuYJk565Ny7RhgWxCwnX7kojZSaun2RbTocAf","weight":1}],"accounts":[],"waits":[]}}
+				]}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"code":500,"message":"Internal Service Error","error":{"code":0,"name":"exception","what":"unspecified","details":[{"message":"unknown key (eosio::chain::name): missing1","file":"http_plugin.cpp","line_number":0,"method":"handle_exception"}]}}`))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	acc, err := api.GetAccount("y5x3sk44d43p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.RAMQuota != 5350 || acc.RAMUsage != 3210 || acc.CPULimit.Used != 200 || acc.NetLimit.Max != 1000 {
+		t.Errorf("resources were not decoded: %+v", acc)
+	}
+	if len(acc.Permissions) != 2 || acc.Permissions[0].PermName != "active" || acc.Permissions[0].Parent != "owner" {
+		t.Fatalf("permissions were not decoded: %+v", acc.Permissions)
+	}
+	if acc.Permissions[0].RequiredAuth.Keys[0].PublicKey.String() != "FIO586ZYe3CA2D3cpuYJk565Ny7RhgWxCwnX7kojZSaun2RbTocAf" {
+		t.Error("wrong active key", acc.Permissions[0].RequiredAuth.Keys[0].PublicKey.String())
+	}
+
+	if _, err = api.GetAccount("missing1"); err != ErrAccountNotFound {
+		t.Errorf("expected ErrAccountNotFound, got %v", err)
+	}
+	srv.Close()
+	if _, err = api.GetAccount("y5x3sk44d43p"); err == nil || err == ErrAccountNotFound {
+		t.Errorf("expected a transport error, got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package fio
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -11,7 +12,9 @@ import (
 	"math"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"crypto/sha1" // #nosec
@@ -30,16 +33,25 @@ type Address string
 //       a-z0-9 is required on either side of any dash
 //    Case-insensitive
 func (a Address) Valid() (ok bool) {
+	return ValidateFioAddress(a) == nil
+}
+
+// ValidateFioAddress checks an address using the same rules as Address.Valid, but returns an error describing
+// which rule was broken.
+func ValidateFioAddress(a Address) error {
 	if len(string(a)) < 3 || len(string(a)) > 64 {
-		return false
+		return fmt.Errorf("address must be between 3 and 64 characters, got %d", len(string(a)))
 	}
-	if bad, err := regexp.MatchString(`(?:--|@@|@.*@|-@|@-|^-|-$)`, string(a)); bad || err != nil {
-		return false
+	if strings.Count(string(a), "@") != 1 {
+		return errors.New("address must contain exactly one @")
 	}
 	if match, err := regexp.MatchString(`^[a-zA-Z0-9-]+[@][a-zA-Z0-9-]+$`, string(a)); err != nil || !match {
-		return false
+		return errors.New("address may only contain a-z, 0-9 and - with a name on both sides of the @")
 	}
-	return true
+	if bad, err := regexp.MatchString(`(?:--|-@|@-|^-|-$)`, string(a)); bad || err != nil {
+		return errors.New("a dash must be surrounded by a-z or 0-9")
+	}
+	return nil
 }
 
 // RegAddress Registers a FIO Address on the FIO blockchain
@@ -52,8 +64,14 @@ type RegAddress struct {
 }
 
 func NewRegAddress(actor eos.AccountName, address Address, ownerPubKey string) (action *Action, ok bool) {
-	if ok := address.Valid(); !ok {
-		return nil, false
+	action, err := NewValidRegAddress(actor, address, ownerPubKey)
+	return action, err == nil
+}
+
+// NewValidRegAddress is the same as NewRegAddress, but returns an error explaining why an address is not valid
+func NewValidRegAddress(actor eos.AccountName, address Address, ownerPubKey string) (*Action, error) {
+	if err := ValidateFioAddress(address); err != nil {
+		return nil, err
 	}
 	return NewAction(
 		"fio.address", "regaddress", actor,
@@ -64,14 +82,14 @@ func NewRegAddress(actor eos.AccountName, address Address, ownerPubKey string) (
 			Actor:             actor,
 			Tpid:              CurrentTpid(),
 		},
-	), true
+	), nil
 }
 
 // MustNewRegAddress panics on a bad address, but allows embedding because it only returns one value
 func MustNewRegAddress(actor eos.AccountName, address Address, ownerPubKey string) (action *Action) {
-	a, ok := NewRegAddress(actor, address, ownerPubKey)
-	if !ok {
-		panic("invalid fio address in call to MustNewRegAddress")
+	a, err := NewValidRegAddress(actor, address, ownerPubKey)
+	if err != nil {
+		panic("invalid fio address in call to MustNewRegAddress: " + err.Error())
 	}
 	return a
 }
@@ -133,9 +151,9 @@ func NewAddAddress(actor eos.AccountName, fioAddress Address, token string, chai
 	}
 	// ensure both chain and token are not empty
 	if token != "" && chain == "" {
-		token = chain
-	} else if chain != "" && token == "" {
 		chain = token
+	} else if chain != "" && token == "" {
+		token = chain
 	} else if chain == "" && token == "" {
 		return nil, false
 	}
@@ -151,26 +169,31 @@ func NewAddAddress(actor eos.AccountName, fioAddress Address, token string, chai
 	), true
 }
 
-// NewAddAddresses adds multiple public addresses at a time
+// NewAddAddresses adds multiple public addresses at a time, up to 5 can be added in a single action
 func NewAddAddresses(actor eos.AccountName, fioAddress Address, addrs []TokenPubAddr) (action *Action, ok bool) {
 	if !fioAddress.Valid() {
 		return nil, false
 	}
-	// fixup struct so both chain code and token code exist
-	for _, a := range addrs {
+	if len(addrs) == 0 || len(addrs) > 5 {
+		return nil, false
+	}
+	// fixup a copy so both chain code and token code exist
+	fixed := make([]TokenPubAddr, len(addrs))
+	for i, a := range addrs {
 		if a.TokenCode != "" && a.ChainCode == "" {
-			a.TokenCode = a.ChainCode
-		} else if a.ChainCode != "" && a.TokenCode == "" {
 			a.ChainCode = a.TokenCode
+		} else if a.ChainCode != "" && a.TokenCode == "" {
+			a.TokenCode = a.ChainCode
 		} else if a.ChainCode == "" && a.TokenCode == "" {
 			return nil, false
 		}
+		fixed[i] = a
 	}
 	return NewAction(
 		"fio.address", "addaddress", actor,
 		AddAddress{
 			FioAddress:      string(fioAddress),
-			PublicAddresses: addrs,
+			PublicAddresses: fixed,
 			MaxFee:          Tokens(GetMaxFee(FeeAddPubAddress)),
 			Tpid:            CurrentTpid(),
 			Actor:           actor,
@@ -284,6 +307,58 @@ func NewTransferAddress(actor eos.AccountName, address Address, newOwnerPubKey s
 	)
 }
 
+// NewTransferDomain is the same as NewTransferDom, but checks the new owner's public key and returns an error if the
+// fee is not known. Legacy EOS-prefixed keys are converted to the FIO prefix the contract expects.
+func NewTransferDomain(actor eos.AccountName, domain string, newOwnerPubKey string) (*Action, error) {
+	pub, err := normalizePubKey(newOwnerPubKey)
+	if err != nil {
+		return nil, err
+	}
+	if domain == "" || strings.Contains(domain, "@") {
+		return nil, errors.New("invalid domain")
+	}
+	fee, err := LookupMaxFee(FeeTransferDom)
+	if err != nil {
+		return nil, err
+	}
+	return NewAction(
+		"fio.address", "xferdomain", actor,
+		TransferDom{
+			FioDomain:            domain,
+			NewOwnerFioPublicKey: pub,
+			MaxFee:               Tokens(fee),
+			Actor:                actor,
+			Tpid:                 CurrentTpid(),
+		},
+	), nil
+}
+
+// NewValidTransferAddress is the same as NewTransferAddress, but checks the address and new owner's public key, and
+// returns an error if the fee is not known. Legacy EOS-prefixed keys are converted to the FIO prefix.
+func NewValidTransferAddress(actor eos.AccountName, address Address, newOwnerPubKey string) (*Action, error) {
+	pub, err := normalizePubKey(newOwnerPubKey)
+	if err != nil {
+		return nil, err
+	}
+	if !address.Valid() {
+		return nil, errors.New("invalid address")
+	}
+	fee, err := LookupMaxFee(FeeTransferAddress)
+	if err != nil {
+		return nil, err
+	}
+	return NewAction(
+		"fio.address", "xferaddress", actor,
+		TransferAddress{
+			FioAddress:           string(address),
+			NewOwnerFioPublicKey: pub,
+			MaxFee:               Tokens(fee),
+			Actor:                actor,
+			Tpid:                 CurrentTpid(),
+		},
+	), nil
+}
+
 // ExpDomain is used by a test contract and not available on mainnet
 //
 // Deprecated: only used in development environments
@@ -501,6 +576,68 @@ type FioName struct {
 	IsPublic   int    `json:"is_public,omitifempty"`
 }
 
+// FioNameSortBy selects the ordering used by SortFioNames
+type FioNameSortBy uint8
+
+const (
+	SortByName FioNameSortBy = iota
+	SortByExpiration
+	SortByDomain
+)
+
+// Name returns the address, or the domain if this is a domain entry
+func (fn FioName) Name() string {
+	if fn.FioAddress != "" {
+		return fn.FioAddress
+	}
+	return fn.FioDomain
+}
+
+// Domain returns the domain portion of an address, or the domain if this is a domain entry
+func (fn FioName) Domain() string {
+	if fn.FioAddress != "" {
+		if i := strings.LastIndex(fn.FioAddress, "@"); i >= 0 {
+			return fn.FioAddress[i+1:]
+		}
+	}
+	return fn.FioDomain
+}
+
+// ExpirationTime parses the Expiration string
+func (fn FioName) ExpirationTime() (time.Time, error) {
+	return ParseChainTime(fn.Expiration)
+}
+
+// SortFioNames returns a sorted copy of names, the original slice is not modified so the node's order is still
+// available. Ties are broken by name. Expirations that cannot be parsed sort last.
+func SortFioNames(names []FioName, by FioNameSortBy) []FioName {
+	sorted := make([]FioName, len(names))
+	copy(sorted, names)
+	expires := func(fn FioName) time.Time {
+		t, err := fn.ExpirationTime()
+		if err != nil {
+			return time.Unix(math.MaxInt32, 0)
+		}
+		return t
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		switch by {
+		case SortByExpiration:
+			ei, ej := expires(sorted[i]), expires(sorted[j])
+			if !ei.Equal(ej) {
+				return ei.Before(ej)
+			}
+		case SortByDomain:
+			di, dj := sorted[i].Domain(), sorted[j].Domain()
+			if di != dj {
+				return di < dj
+			}
+		}
+		return sorted[i].Name() < sorted[j].Name()
+	})
+	return sorted
+}
+
 type getFioNamesRequest struct {
 	FioPublicKey string `json:"fio_public_key"`
 	Limit        uint32 `json:"limit,omitempty"`
@@ -509,11 +646,16 @@ type getFioNamesRequest struct {
 
 // GetFioNames provides a list of domains and addresses for a public key
 func (api *API) GetFioNames(pubKey string) (names FioNames, found bool, err error) {
+	return api.GetFioNamesCtx(context.Background(), pubKey)
+}
+
+// GetFioNamesCtx is the same as GetFioNames, but the request is cancelled when ctx is done
+func (api *API) GetFioNamesCtx(ctx context.Context, pubKey string) (names FioNames, found bool, err error) {
 	query := getFioNamesRequest{
 		FioPublicKey: pubKey,
 	}
 	j, _ := json.Marshal(query)
-	req, err := http.NewRequest("POST", api.BaseURL+`/v1/chain/get_fio_names`, bytes.NewBuffer(j))
+	req, err := http.NewRequestWithContext(ctx, "POST", api.BaseURL+`/v1/chain/get_fio_names`, bytes.NewBuffer(j))
 	if err != nil {
 		return FioNames{}, false, err
 	}
@@ -671,12 +813,44 @@ func flip(b []byte) []byte {
 
 // DomainResp holds the table query lookup result for a domain
 type DomainResp struct {
+	Id         uint64           `json:"id"`
 	Name       string           `json:"name"`
+	DomainHash eos.Uint128      `json:"domainhash"`
 	IsPublic   uint8            `json:"is_public"`
 	Expiration int64            `json:"expiration"`
 	Account    *eos.AccountName `json:"account,omitempty"`
 }
 
+// DomainsTableResp is a page of the fio.address domains table
+type DomainsTableResp struct {
+	Domains []DomainResp `json:"domains"`
+	More    bool         `json:"more"`
+}
+
+// GetDomainsTable reads the fio.address domains table by id, starting at lowerBound (empty for the first row). To
+// get the next page use the last Id + 1 as the lowerBound.
+func (api *API) GetDomainsTable(limit int, lowerBound string) (*DomainsTableResp, error) {
+	if limit < 1 {
+		return nil, errors.New("limit must be positive")
+	}
+	gtr, err := api.GetTableRows(eos.GetTableRowsRequest{
+		Code:       "fio.address",
+		Scope:      "fio.address",
+		Table:      "domains",
+		LowerBound: lowerBound,
+		Limit:      uint32(limit),
+		JSON:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := &DomainsTableResp{Domains: make([]DomainResp, 0), More: gtr.More}
+	if err = json.Unmarshal(gtr.Rows, &resp.Domains); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 // GetDomainOwner finds the account that is the owner of a domain
 func (api *API) GetDomainOwner(domain string) (actor *eos.AccountName, err error) {
 	dnh := DomainNameHash(domain)
@@ -740,6 +914,20 @@ func (api *API) AvailCheck(addressOrDomain string) (available bool, err error) {
 	return false, nil
 }
 
+// IsFioAddressAvailable checks if a FIO address can be registered. Unlike AvailCheck, the address format is checked
+// first, and an error response from the node is returned as an error rather than being reported as available.
+func (api *API) IsFioAddressAvailable(address Address) (bool, error) {
+	if !address.Valid() {
+		return false, errors.New("invalid address")
+	}
+	isReg := &AvailCheckResp{}
+	err := api.call("chain", "avail_check", &AvailCheckReq{FioName: string(address)}, isReg)
+	if err != nil {
+		return false, err
+	}
+	return isReg.IsRegistered == 0, nil
+}
+
 type RemoveAddrReq struct {
 	FioAddress      string          `json:"fio_address"`
 	PublicAddresses []TokenPubAddr  `json:"public_addresses"`
@@ -756,12 +944,16 @@ func NewRemoveAddrReq(fioAddress Address, toRemove []TokenPubAddr, actor eos.Acc
 	if toRemove == nil || len(toRemove) == 0 {
 		return nil, errors.New("empty address list supplied")
 	}
+	fee, err := LookupMaxFee(FeeRemovePubAddress)
+	if err != nil {
+		return nil, err
+	}
 	return NewAction(
 		"fio.address", "remaddress", actor,
 		RemoveAddrReq{
 			FioAddress:      string(fioAddress),
 			PublicAddresses: toRemove,
-			MaxFee:          Tokens(GetMaxFee(FeeRemovePubAddress)),
+			MaxFee:          Tokens(fee),
 			Actor:           actor,
 			Tpid:            CurrentTpid(),
 		},
@@ -781,11 +973,49 @@ func NewRemoveAllAddrReq(fioAddress Address, actor eos.AccountName) (remove *Act
 	if !fioAddress.Valid() {
 		return nil, errors.New("invalid address")
 	}
+	fee, err := LookupMaxFee(FeeRemoveAllAddresses)
+	if err != nil {
+		return nil, err
+	}
 	return NewAction(
 		"fio.address", "remalladdr", actor,
 		RemoveAllAddrReq{
 			FioAddress: string(fioAddress),
-			MaxFee:     Tokens(GetMaxFee(FeeRemoveAllAddresses)),
+			MaxFee:     Tokens(fee),
+			Actor:      actor,
+			Tpid:       CurrentTpid(),
+		},
+	), nil
+}
+
+// AddBundles purchases additional sets of bundled transactions for an address
+type AddBundles struct {
+	FioAddress string          `json:"fio_address"`
+	BundleSets int64           `json:"bundle_sets"`
+	MaxFee     uint64          `json:"max_fee"`
+	Actor      eos.AccountName `json:"actor"`
+	Tpid       string          `json:"tpid"`
+}
+
+// NewAddBundledTransactions tops up the free bundled transactions for an address, the fee is charged per set so the
+// max fee is scaled by bundleSets.
+func NewAddBundledTransactions(actor eos.AccountName, address string, bundleSets int) (*Action, error) {
+	if bundleSets < 1 {
+		return nil, errors.New("bundleSets must be at least 1")
+	}
+	if err := ValidateFioAddress(Address(address)); err != nil {
+		return nil, err
+	}
+	fee, err := LookupMaxFee(FeeAddBundles)
+	if err != nil {
+		return nil, err
+	}
+	return NewAction(
+		"fio.address", "addbundles", actor,
+		AddBundles{
+			FioAddress: address,
+			BundleSets: int64(bundleSets),
+			MaxFee:     Tokens(fee) * uint64(bundleSets),
 			Actor:      actor,
 			Tpid:       CurrentTpid(),
 		},
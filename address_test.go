@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"github.com/fioprotocol/fio-go/eos"
 	"math/rand"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -501,3 +503,399 @@ func TestRemoveAddr(t *testing.T) {
 	}
 
 }
+
+func TestSortFioNames(t *testing.T) {
+	raw := []FioName{
+		{FioAddress: "zed@alpha", Expiration: "2022-01-01T00:00:00"},
+		{FioAddress: "bob@gamma", Expiration: "2021-06-01T00:00:00"},
+		{FioAddress: "amy@beta", Expiration: "bad"},
+		{FioAddress: "carl@alpha", Expiration: "2021-01-01T00:00:00"},
+	}
+	order := func(names []FioName) string {
+		s := make([]string, len(names))
+		for i := range names {
+			s[i] = names[i].Name()
+		}
+		return strings.Join(s, ",")
+	}
+	for _, tc := range []struct {
+		by   FioNameSortBy
+		want string
+	}{
+		{SortByName, "amy@beta,bob@gamma,carl@alpha,zed@alpha"},
+		{SortByExpiration, "carl@alpha,bob@gamma,zed@alpha,amy@beta"},
+		{SortByDomain, "carl@alpha,zed@alpha,amy@beta,bob@gamma"},
+	} {
+		if got := order(SortFioNames(raw, tc.by)); got != tc.want {
+			t.Errorf("sort mode %d: got %s, want %s", tc.by, got, tc.want)
+		}
+	}
+	if order(raw) != "zed@alpha,bob@gamma,amy@beta,carl@alpha" {
+		t.Error("SortFioNames modified the original slice")
+	}
+	if (FioName{FioDomain: "alpha"}).Domain() != "alpha" {
+		t.Error("domain entry should return its domain")
+	}
+}
+
+func TestAPI_GetFioNames_mock(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_fio_names" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"fio_domains":[{"fio_domain":"dapixdev","expiration":"2022-03-30T17:44:58","is_public":1}],` +
+			`"fio_addresses":[{"fio_address":"ada@dapixdev","expiration":"2021-09-30T17:44:58"},{"fio_address":"bob@dapixdev","expiration":"2021-10-30T17:44:58"}]}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	names, found, err := api.GetFioNames("FIO5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82")
+	if err != nil || !found {
+		t.Fatalf("expected names, got %v", err)
+	}
+	if len(names.FioDomains) != 1 || len(names.FioAddresses) != 2 {
+		t.Fatalf("expected 1 domain and 2 addresses, got %d and %d", len(names.FioDomains), len(names.FioAddresses))
+	}
+	exp, err := names.FioDomains[0].ExpirationTime()
+	if err != nil || exp.Year() != 2022 || names.FioDomains[0].IsPublic != 1 {
+		t.Errorf("domain was not decoded: %+v", names.FioDomains[0])
+	}
+	if names.FioAddresses[1].FioAddress != "bob@dapixdev" || names.FioAddresses[1].Expiration != "2021-10-30T17:44:58" {
+		t.Errorf("address was not decoded: %+v", names.FioAddresses[1])
+	}
+}
+
+func TestNewRenewDomainAddress(t *testing.T) {
+	prev := CurrentTpid()
+	defer SetTpid(prev)
+	SetTpid("tpid@fiotestnet")
+
+	dom := NewRenewDomain("htjonrkf1lgs", "dapixdev")
+	if dom.Account != "fio.address" || dom.Name != "renewdomain" {
+		t.Errorf("wrong contract or action: %s::%s", dom.Account, dom.Name)
+	}
+	d := dom.Data.(RenewDomain)
+	if d.FioDomain != "dapixdev" || d.Actor != "htjonrkf1lgs" || d.Tpid != "tpid@fiotestnet" {
+		t.Errorf("unexpected action data: %+v", d)
+	}
+	if d.MaxFee != Tokens(GetMaxFee(FeeRenewFioDomain)) {
+		t.Error("max fee was not populated")
+	}
+
+	addr := NewRenewAddress("htjonrkf1lgs", "ada@dapixdev")
+	if addr.Account != "fio.address" || addr.Name != "renewaddress" {
+		t.Errorf("wrong contract or action: %s::%s", addr.Account, addr.Name)
+	}
+	a := addr.Data.(RenewAddress)
+	if a.FioAddress != "ada@dapixdev" || a.Actor != "htjonrkf1lgs" || a.Tpid != "tpid@fiotestnet" {
+		t.Errorf("unexpected action data: %+v", a)
+	}
+	if a.MaxFee != Tokens(GetMaxFee(FeeRenewFioAddress)) {
+		t.Error("max fee was not populated")
+	}
+}
+
+func TestNewSetDomainPub(t *testing.T) {
+	for _, public := range []bool{true, false} {
+		act := NewSetDomainPub("htjonrkf1lgs", "dapixdev", public)
+		if act.Account != "fio.address" || act.Name != "setdomainpub" {
+			t.Errorf("wrong contract or action: %s::%s", act.Account, act.Name)
+		}
+		d := act.Data.(SetDomainPub)
+		want := uint8(0)
+		if public {
+			want = 1
+		}
+		if d.IsPublic != want {
+			t.Errorf("public %v should map to is_public %d, got %d", public, want, d.IsPublic)
+		}
+		if d.FioDomain != "dapixdev" || d.Actor != "htjonrkf1lgs" || d.MaxFee != Tokens(GetMaxFee(FeeSetDomainPub)) {
+			t.Errorf("unexpected action data: %+v", d)
+		}
+	}
+}
+
+func TestNewTransferDomainAddress(t *testing.T) {
+	const (
+		fioKey = "FIO5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82"
+		eosKey = "EOS5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82"
+	)
+	dom, err := NewTransferDomain("htjonrkf1lgs", "dapixdev", eosKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dom.Name != "xferdomain" || dom.Data.(TransferDom).NewOwnerFioPublicKey != fioKey {
+		t.Errorf("unexpected action: %s %+v", dom.Name, dom.Data)
+	}
+	if dom.Data.(TransferDom).MaxFee != Tokens(GetMaxFee(FeeTransferDom)) {
+		t.Error("max fee was not populated")
+	}
+	addr, err := NewValidTransferAddress("htjonrkf1lgs", "ada@dapixdev", fioKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.Name != "xferaddress" || addr.Data.(TransferAddress).NewOwnerFioPublicKey != fioKey {
+		t.Errorf("unexpected action: %s %+v", addr.Name, addr.Data)
+	}
+
+	for _, bad := range []string{"", "PUB5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82", "FIO5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh83"} {
+		if _, err = NewTransferDomain("htjonrkf1lgs", "dapixdev", bad); err == nil {
+			t.Errorf("key %q should be rejected", bad)
+		}
+		if _, err = NewValidTransferAddress("htjonrkf1lgs", "ada@dapixdev", bad); err == nil {
+			t.Errorf("key %q should be rejected", bad)
+		}
+	}
+	if _, err = NewValidTransferAddress("htjonrkf1lgs", "not an address", fioKey); err == nil {
+		t.Error("invalid address should be rejected")
+	}
+}
+
+func TestAPI_IsFioAddressAvailable(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/avail_check" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := &AvailCheckReq{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+		switch req.FioName {
+		case "taken@dapixdev":
+			_, _ = w.Write([]byte(`{"is_registered":1}`))
+		case "free@dapixdev":
+			_, _ = w.Write([]byte(`{"is_registered":0}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":400,"message":"Invalid fio_name"}`))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	if avail, err := api.IsFioAddressAvailable("free@dapixdev"); err != nil || !avail {
+		t.Errorf("expected available, got %v %v", avail, err)
+	}
+	if avail, err := api.IsFioAddressAvailable("taken@dapixdev"); err != nil || avail {
+		t.Errorf("expected taken, got %v %v", avail, err)
+	}
+	if _, err := api.IsFioAddressAvailable("other@dapixdev"); err == nil {
+		t.Error("expected an error from a failed request")
+	}
+	if _, err := api.IsFioAddressAvailable("not valid"); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestValidateFioAddress(t *testing.T) {
+	for a, want := range map[string]string{
+		"a@" + strings.Repeat("b", 63): "between 3 and 64",
+		"two@at@signs":                 "exactly one @",
+		"no-at-sign":                   "exactly one @",
+		"bang!not@allowed":             "may only contain",
+		"under_not@allowed":            "may only contain",
+		"@missingname":                 "may only contain",
+		"no--double@dash":              "dash must be surrounded",
+		"trailing@dash-":               "dash must be surrounded",
+	} {
+		err := ValidateFioAddress(Address(a))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", a, want, err)
+		}
+	}
+	if err := ValidateFioAddress("ada@dapixdev"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NewValidRegAddress("htjonrkf1lgs", "bad!@dapixdev", ""); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+	act, err := NewValidRegAddress("htjonrkf1lgs", "ada@dapixdev", "FIO5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82")
+	if err != nil || act.Data.(RegAddress).FioAddress != "ada@dapixdev" {
+		t.Errorf("unexpected result: %v %v", act, err)
+	}
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "exactly one @") {
+			t.Errorf("expected MustNewRegAddress to panic with the reason, got %v", r)
+		}
+	}()
+	MustNewRegAddress("htjonrkf1lgs", "bad", "")
+}
+
+func TestAPI_GetBundleRemaining_mock(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_table_rows" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := &eos.GetTableRowsRequest{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+		if req.Table != "fionames" || req.LowerBound != I128Hash("ada@dapixdev") {
+			_, _ = w.Write([]byte(`{"rows":[],"more":false}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"rows":[{"name":"ada@dapixdev","bundleeligiblecountdown":87}],"more":false}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	rem, err := api.GetBundleRemaining("ada@dapixdev")
+	if err != nil || rem != 87 {
+		t.Errorf("expected 87 remaining, got %d %v", rem, err)
+	}
+	rem, err = api.GetBundleRemaining("bob@dapixdev")
+	if err != nil || rem != 0 {
+		t.Errorf("expected 0 for an unknown address, got %d %v", rem, err)
+	}
+	if _, err = api.GetBundleRemaining("invalid"); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestNewAddBundledTransactions(t *testing.T) {
+	act, err := NewAddBundledTransactions("htjonrkf1lgs", "ada@dapixdev", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Account != "fio.address" || act.Name != "addbundles" {
+		t.Errorf("wrong contract or action: %s::%s", act.Account, act.Name)
+	}
+	d := act.Data.(AddBundles)
+	if d.FioAddress != "ada@dapixdev" || d.BundleSets != 2 || d.MaxFee != 2*Tokens(GetMaxFee(FeeAddBundles)) {
+		t.Errorf("unexpected action data: %+v", d)
+	}
+	if GetMaxFeeByAction("addbundles") != GetMaxFee(FeeAddBundles) {
+		t.Error("addbundles is not mapped to its fee")
+	}
+	if _, err = NewAddBundledTransactions("htjonrkf1lgs", "ada@dapixdev", 0); err == nil {
+		t.Error("expected an error for zero bundle sets")
+	}
+	if _, err = NewAddBundledTransactions("htjonrkf1lgs", "invalid", 1); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestNewAddAddresses_codes(t *testing.T) {
+	act, ok := NewAddAddress("htjonrkf1lgs", "ada@dapixdev", "ETH", "", "0xdeadbeef")
+	if !ok {
+		t.Fatal("expected a valid action")
+	}
+	if pa := act.Data.(AddAddress).PublicAddresses[0]; pa.ChainCode != "ETH" || pa.TokenCode != "ETH" {
+		t.Errorf("chain code should default to the token code: %+v", pa)
+	}
+
+	in := []TokenPubAddr{
+		{ChainCode: "ETH", PublicAddress: "0xdeadbeef"},
+		{TokenCode: "USDT", ChainCode: "ETH", PublicAddress: "0xdeadbeef"},
+	}
+	act, ok = NewAddAddresses("htjonrkf1lgs", "ada@dapixdev", in)
+	if !ok {
+		t.Fatal("expected a valid action")
+	}
+	out := act.Data.(AddAddress).PublicAddresses
+	if out[0].TokenCode != "ETH" || out[1].TokenCode != "USDT" || out[1].ChainCode != "ETH" {
+		t.Errorf("codes were not fixed up: %+v", out)
+	}
+	if in[0].TokenCode != "" {
+		t.Error("caller's slice should not be modified")
+	}
+	if _, ok = NewAddAddresses("htjonrkf1lgs", "ada@dapixdev", make([]TokenPubAddr, 6)); ok {
+		t.Error("more than 5 addresses should be rejected")
+	}
+	if _, ok = NewAddAddresses("htjonrkf1lgs", "ada@dapixdev", []TokenPubAddr{{PublicAddress: "0x"}}); ok {
+		t.Error("missing codes should be rejected")
+	}
+
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_pub_address" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := make(map[string]string)
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["chain_code"] == "ETH" && req["token_code"] == "ETH" {
+			_, _ = w.Write([]byte(`{"public_address":"0xdeadbeef"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"Public address not found"}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	pub, found, err := api.PubAddressLookup("ada@dapixdev", "ETH", "")
+	if err != nil || !found || pub.PublicAddress != "0xdeadbeef" {
+		t.Errorf("expected the mapped address, got %+v %v %v", pub, found, err)
+	}
+	if _, found, _ = api.PubAddressLookup("ada@dapixdev", "BTC", ""); found {
+		t.Error("unmapped chain should not be found")
+	}
+}
+
+func TestNewRemoveAddrReq_offline(t *testing.T) {
+	rm, err := NewRemoveAddrReq("ada@dapixdev", []TokenPubAddr{{TokenCode: "ETH", ChainCode: "ETH", PublicAddress: "0xdeadbeef"}}, "htjonrkf1lgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rm.Name != "remaddress" || rm.Data.(RemoveAddrReq).MaxFee != Tokens(GetMaxFee(FeeRemovePubAddress)) {
+		t.Errorf("unexpected action: %s %+v", rm.Name, rm.Data)
+	}
+	if _, err = NewRemoveAddrReq("ada@dapixdev", nil, "htjonrkf1lgs"); err == nil {
+		t.Error("expected an error for an empty list")
+	}
+	all, err := NewRemoveAllAddrReq("ada@dapixdev", "htjonrkf1lgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all.Name != "remalladdr" || all.Data.(RemoveAllAddrReq).FioAddress != "ada@dapixdev" {
+		t.Errorf("unexpected action: %s %+v", all.Name, all.Data)
+	}
+	if _, err = NewRemoveAllAddrReq("invalid", "htjonrkf1lgs"); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestAPI_GetDomainsTable(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_table_rows" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := &eos.GetTableRowsRequest{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+		if req.Code != "fio.address" || req.Table != "domains" || req.LowerBound != "5" || req.Limit != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"rows":[` +
+			`{"id":5,"name":"dapixdev","domainhash":"0x0c2dd1d0ab1b1ed6e3c8d9f2a6e0d0a1","account":"htjonrkf1lgs","is_public":1,"expiration":1700000000},` +
+			`{"id":6,"name":"fiotestnet","domainhash":"0x7a1e15c0e5e1bd5b1a2b0c2f0b3e7a90","account":"eosio","is_public":0,"expiration":1800000000}` +
+			`],"more":true}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	resp, err := api.GetDomainsTable(2, "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.More || len(resp.Domains) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	d := resp.Domains[1]
+	if d.Id != 6 || d.Name != "fiotestnet" || d.IsPublic != 0 || *d.Account != "eosio" || d.Expiration != 1800000000 {
+		t.Errorf("unexpected domain: %+v", d)
+	}
+	if _, err = api.GetDomainsTable(0, ""); err == nil {
+		t.Error("expected an error for a zero limit")
+	}
+}
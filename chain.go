@@ -2,6 +2,7 @@ package fio
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
@@ -14,8 +15,11 @@ import (
 	"math"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -23,9 +27,107 @@ const (
 	ChainIdTestnet = `b20901380af44ef59c5918439a1f9a41d83669020319a80574b804a5f95cbd7e`
 )
 
-// API struct allows extending the eos.API with FIO-specific functions
+// ChainTimeFormat is the layout nodeos uses for timestamps, always UTC and without a zone suffix.
+const ChainTimeFormat = "2006-01-02T15:04:05.000000"
+
+// ParseChainTime parses a timestamp from a chain response. Fractional seconds are optional and may be any precision,
+// a trailing 'Z' is tolerated. The result is always UTC.
+func ParseChainTime(s string) (time.Time, error) {
+	s = strings.TrimSuffix(strings.Trim(s, `"`), "Z")
+	t, err := time.ParseInLocation(eos.JSONTimeFormat, s, time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// FormatChainTime formats a time using ChainTimeFormat
+func FormatChainTime(t time.Time) string {
+	return t.UTC().Format(ChainTimeFormat)
+}
+
+// API struct allows extending the eos.API with FIO-specific functions. An API is safe for concurrent use by
+// multiple goroutines: each request uses its own buffers, and settings such as SetTpid or SetMaxTransferPerTx are
+// guarded. Fields such as Header, Debug, and RetryPolicy should be set before the API is shared.
 type API struct {
 	*eos.API
+
+	// RetryPolicy controls SignPushActionsRetry, DefaultRetryPolicy is used if nil
+	RetryPolicy *RetryPolicy
+
+	policyMux        sync.RWMutex
+	maxTransferPerTx uint64
+	tpid             string
+
+	// failover is set by NewConnectionMulti
+	failover *failoverTransport
+
+	chainIdMux sync.Mutex
+	chainId    eos.Checksum256
+
+	closeMux sync.Mutex
+	done     chan struct{}
+}
+
+// ErrClosed is returned by requests made after API.Close
+var ErrClosed = errors.New("api is closed")
+
+// doneChan returns a channel that is closed when Close is called
+func (api *API) doneChan() chan struct{} {
+	api.closeMux.Lock()
+	defer api.closeMux.Unlock()
+	if api.done == nil {
+		api.done = make(chan struct{})
+	}
+	return api.done
+}
+
+// isClosed reports whether Close has been called
+func (api *API) isClosed() bool {
+	select {
+	case <-api.doneChan():
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops any background goroutines started by the API (such as WatchPendingRequests) and closes idle
+// connections. For connections created using NewConnection, later requests fail with ErrClosed. Close is idempotent.
+func (api *API) Close() error {
+	done := api.doneChan()
+	api.closeMux.Lock()
+	select {
+	case <-done:
+	default:
+		close(done)
+	}
+	api.closeMux.Unlock()
+	if api.API != nil && api.HttpClient != nil {
+		api.HttpClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// closableTransport rejects requests once the API is closed
+type closableTransport struct {
+	next http.RoundTripper
+	done <-chan struct{}
+}
+
+func (ct *closableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-ct.done:
+		return nil, ErrClosed
+	default:
+	}
+	return ct.next.RoundTrip(req)
+}
+
+func (ct *closableTransport) CloseIdleConnections() {
+	if ci, ok := ct.next.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
 }
 
 // Action struct duplicates eos.Action
@@ -34,6 +136,9 @@ type Action struct {
 	Name          eos.ActionName        `json:"name"`
 	Authorization []eos.PermissionLevel `json:"authorization,omitempty"`
 	eos.ActionData
+
+	// tpidSet is true when WithTpid or WithNoTpid chose the tpid, so an API's tpid will not replace it
+	tpidSet bool
 }
 
 func (act Action) ToEos() *eos.Action {
@@ -81,12 +186,26 @@ func NewTransaction(actions []*Action, txOpts *TxOptions) *eos.Transaction {
 			},
 		)
 	}
+	if txOpts == nil {
+		return eos.NewTransaction(eosActions, nil)
+	}
 	return eos.NewTransaction(eosActions, txOpts.toEos())
 }
 
 // NewConnection sets up the API interface for interacting with the FIO API
 func NewConnection(keyBag *eos.KeyBag, url string) (*API, *TxOptions, error) {
+	return NewConnectionWithClient(keyBag, url, nil)
+}
+
+// NewConnectionWithClient is the same as NewConnection, but requests are sent using a copy of the supplied
+// http.Client, allowing a tuned transport with connection pooling and timeouts. The default client is used if nil.
+func NewConnectionWithClient(keyBag *eos.KeyBag, url string, client *http.Client) (*API, *TxOptions, error) {
 	var api = eos.New(url)
+	if client != nil {
+		// copied so wrapping the transport below doesn't change the caller's client
+		c := *client
+		api.HttpClient = &c
+	}
 	api.SetSigner(keyBag)
 	api.SetCustomGetRequiredKeys(
 		func(tx *eos.Transaction) (keys []ecc.PublicKey, e error) {
@@ -99,8 +218,12 @@ func NewConnection(keyBag *eos.KeyBag, url string) (*API, *TxOptions, error) {
 	if err != nil {
 		return &API{}, nil, err
 	}
-	a := &API{api}
-	if !maxFeesUpdated {
+	a := &API{API: api}
+	if api.HttpClient.Transport == nil {
+		api.HttpClient.Transport = http.DefaultTransport
+	}
+	api.HttpClient.Transport = &closableTransport{next: api.HttpClient.Transport, done: a.doneChan()}
+	if !MaxFeesUpdated() {
 		_ = a.RefreshFees()
 	}
 	return a, txOpts, nil
@@ -146,6 +269,104 @@ func NewActionWithPermission(contract eos.AccountName, name eos.ActionName, acto
 	}
 }
 
+// GetInfo returns the chain id, server version, and the head and last irreversible blocks
+func (api *API) GetInfo() (out *eos.InfoResp, err error) {
+	return api.GetInfoCtx(context.Background())
+}
+
+// GetInfoCtx is the same as GetInfo, but the request is cancelled when ctx is done
+func (api *API) GetInfoCtx(ctx context.Context) (out *eos.InfoResp, err error) {
+	// the head block time is decoded with ParseChainTime, which is more forgiving than eos.JSONTime
+	resp := &struct {
+		*eos.InfoResp
+		HeadBlockTime string `json:"head_block_time"`
+	}{InfoResp: &eos.InfoResp{}}
+	if err = api.callCtx(ctx, "chain", "get_info", nil, resp); err != nil {
+		return nil, err
+	}
+	out = resp.InfoResp
+	if resp.HeadBlockTime != "" {
+		t, err := ParseChainTime(resp.HeadBlockTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid head_block_time: %w", err)
+		}
+		out.HeadBlockTime = eos.JSONTime{Time: t}
+	}
+	if len(out.ChainID) > 0 {
+		api.chainIdMux.Lock()
+		if api.chainId == nil {
+			api.chainId = out.ChainID
+		}
+		api.chainIdMux.Unlock()
+	}
+	return
+}
+
+// ChainID returns the chain id of the network, it is only requested from the node once since it never changes
+func (api *API) ChainID() (eos.Checksum256, error) {
+	api.chainIdMux.Lock()
+	id := api.chainId
+	api.chainIdMux.Unlock()
+	if id != nil {
+		return id, nil
+	}
+	info, err := api.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	if len(info.ChainID) == 0 {
+		return nil, errors.New("get_info did not return a chain id")
+	}
+	return info.ChainID, nil
+}
+
+// WaitForIrreversible polls get_info until the last irreversible block is at least blockNum, or returns an error once
+// timeout has elapsed. The block a transaction was included in can be found using PushedBlockNum.
+func (api *API) WaitForIrreversible(blockNum uint32, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := api.waitForIrreversible(ctx, blockNum); err != nil {
+		return fmt.Errorf("block %d was not irreversible after %s: %w", blockNum, timeout, err)
+	}
+	return nil
+}
+
+// PushedBlockNum returns the block number a transaction from SignPushActions was included in
+func PushedBlockNum(resp *eos.PushTransactionFullResp) uint32 {
+	if resp == nil {
+		return 0
+	}
+	return resp.Processed.BlockNum
+}
+
+// waitForIrreversible polls get_info until the last irreversible block is at least blockNum. Transport errors and
+// 5xx responses are retried, anything else (such as ErrClosed or a malformed response) is returned immediately.
+func (api *API) waitForIrreversible(ctx context.Context, blockNum uint32) error {
+	for {
+		info, err := api.GetInfoCtx(ctx)
+		switch {
+		case err == nil && info.LastIrreversibleBlockNum >= blockNum:
+			return nil
+		case err != nil && ctx.Err() == nil && !isTransient(err):
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// isTransient reports whether a request might succeed if retried: the node could not be reached, or it returned a 5xx
+func isTransient(err error) bool {
+	if apiErr, ok := AsAPIError(err); ok {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	urlErr := &url.Error{}
+	return errors.As(err, &urlErr)
+}
+
 // GetCurrentBlock provides the current head block number
 func (api *API) GetCurrentBlock() (blockNum uint32) {
 	info, err := api.GetInfo()
@@ -195,27 +416,11 @@ func (api *API) PushEndpointRaw(endpoint string, body interface{}) (out json.Raw
 	if err != nil {
 		return nil, fmt.Errorf("Copy: %s", err)
 	}
-	if resp.StatusCode == 404 {
-		var apiErr eos.APIError
-		if err := json.Unmarshal(cnt.Bytes(), &apiErr); err != nil {
-			return nil, eos.ErrNotFound
-		}
-		return nil, apiErr
-	}
 	if resp.StatusCode > 299 {
-		var apiErr eos.APIError
-		if err := json.Unmarshal(cnt.Bytes(), &apiErr); err != nil {
-			return nil, fmt.Errorf("%s: status code=%d, body=%s", req.URL.String(), resp.StatusCode, cnt.String())
-		}
-		// Handle cases where some API calls (/v1/chain/get_account for example) returns a 500
-		// error when retrieving data that does not exist.
-		if apiErr.IsUnknownKeyError() {
-			return nil, eos.ErrNotFound
-		}
-		return nil, apiErr
+		return nil, newAPIError(resp.StatusCode, cnt.Bytes())
 	}
 	if err := json.Unmarshal(cnt.Bytes(), &out); err != nil {
-		return nil, fmt.Errorf("Unmarshal: %s", err)
+		return nil, fmt.Errorf("Unmarshal: %w", err)
 	}
 	return out, nil
 }
@@ -585,13 +790,21 @@ func (api *API) GetSupportedApis() (onlySafe bool, apis []string, err error) {
 }
 
 func (api *API) call(baseAPI string, endpoint string, body interface{}, out interface{}) error {
+	return api.callCtx(context.Background(), baseAPI, endpoint, body, out)
+}
+
+// callCtx is the same as call, but the request is bound to a context
+func (api *API) callCtx(ctx context.Context, baseAPI string, endpoint string, body interface{}, out interface{}) error {
+	if api.isClosed() {
+		return ErrClosed
+	}
 	jsonBody, err := enc(body)
 	if err != nil {
 		return err
 	}
 
 	targetURL := fmt.Sprintf("%s/v1/%s/%s", api.BaseURL, baseAPI, endpoint)
-	req, err := http.NewRequest("POST", targetURL, jsonBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", targetURL, jsonBody)
 	if err != nil {
 		return fmt.Errorf("NewRequest: %s", err)
 	}
@@ -616,37 +829,20 @@ func (api *API) call(baseAPI string, endpoint string, body interface{}, out inte
 
 	resp, err := api.HttpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("%s: %s", req.URL.String(), err)
+		return fmt.Errorf("%s: %w", req.URL.String(), err)
 	}
 	defer resp.Body.Close()
 
 	var cnt bytes.Buffer
 	_, err = io.Copy(&cnt, resp.Body)
 	if err != nil {
-		return fmt.Errorf("Copy: %s", err)
-	}
-
-	if resp.StatusCode == 404 {
-		var apiErr eos.APIError
-		if err := json.Unmarshal(cnt.Bytes(), &apiErr); err != nil {
-			return eos.ErrNotFound
-		}
-		return apiErr
+		return fmt.Errorf("Copy: %w", err)
 	}
 
+	// some API calls (/v1/chain/get_account for example) return a 500 when data does not exist, these are
+	// returned as eos.ErrNotFound
 	if resp.StatusCode > 299 {
-		var apiErr eos.APIError
-		if err := json.Unmarshal(cnt.Bytes(), &apiErr); err != nil {
-			return fmt.Errorf("%s: status code=%d, body=%s", req.URL.String(), resp.StatusCode, cnt.String())
-		}
-
-		// Handle cases where some API calls (/v1/chain/get_account for example) returns a 500
-		// error when retrieving data that does not exist.
-		if apiErr.IsUnknownKeyError() {
-			return eos.ErrNotFound
-		}
-
-		return apiErr
+		return newAPIError(resp.StatusCode, cnt.Bytes())
 	}
 
 	if api.Debug {
@@ -663,7 +859,7 @@ func (api *API) call(baseAPI string, endpoint string, body interface{}, out inte
 	}
 
 	if err := json.Unmarshal(cnt.Bytes(), &out); err != nil {
-		return fmt.Errorf("Unmarshal: %s", err)
+		return fmt.Errorf("Unmarshal: %w", err)
 	}
 
 	return nil
@@ -691,9 +887,166 @@ func enc(v interface{}) (io.Reader, error) {
 // level function on top of the `/v1/chain/push_transaction` endpoint.
 // Overridden from eos-go to make it unnecessary to use .ToEos() casting on actions.
 func (api *API) SignPushActions(a ...*Action) (out *eos.PushTransactionFullResp, err error) {
+	if err = api.checkTransferPolicy(a); err != nil {
+		return nil, err
+	}
+	a = api.applyTpid(a)
 	b := make([]*eos.Action, len(a))
 	for i, act := range a {
 		b[i] = act.ToEos()
 	}
 	return api.SignPushActionsWithOpts(b, nil)
 }
+
+// signPushActionsCtx is the same as SignPushActions, but the get_info and push_transaction requests are bound to ctx
+func (api *API) signPushActionsCtx(ctx context.Context, a ...*Action) (out *eos.PushTransactionFullResp, err error) {
+	if err = api.checkTransferPolicy(a); err != nil {
+		return nil, err
+	}
+	a = api.applyTpid(a)
+	b := make([]*eos.Action, len(a))
+	for i, act := range a {
+		b[i] = act.ToEos()
+	}
+	info, err := api.GetInfoCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts := &eos.TxOptions{ChainID: info.ChainID, HeadBlockID: info.HeadBlockID}
+	_, packed, err := api.SignTransaction(eos.NewTransaction(b, opts), opts.ChainID, opts.Compress)
+	if err != nil {
+		return nil, err
+	}
+	err = api.callCtx(ctx, "chain", "push_transaction", packed, &out)
+	return
+}
+
+// PushTransaction is the same as eos.API.PushTransaction, but refuses transactions over the limit set with
+// SetMaxTransferPerTx.
+func (api *API) PushTransaction(tx *eos.PackedTransaction) (out *eos.PushTransactionFullResp, err error) {
+	if limit := api.MaxTransferPerTx(); limit > 0 {
+		if tx == nil {
+			return nil, errors.New("transaction is nil")
+		}
+		signed, err := tx.Unpack()
+		if err != nil {
+			return nil, fmt.Errorf("%w: could not unpack transaction: %v", ErrTransferPolicy, err)
+		}
+		if err = checkTransferLimit(signed.Actions, limit); err != nil {
+			return nil, err
+		}
+	}
+	return api.API.PushTransaction(tx)
+}
+
+// SignPushTransaction is the same as eos.API.SignPushTransaction, but is sent using API.PushTransaction
+func (api *API) SignPushTransaction(tx *eos.Transaction, chainID eos.Checksum256, compression eos.CompressionType) (out *eos.PushTransactionFullResp, err error) {
+	_, packed, err := api.SignTransaction(tx, chainID, compression)
+	if err != nil {
+		return nil, err
+	}
+	return api.PushTransaction(packed)
+}
+
+// SignPushActionsWithOpts is the same as eos.API.SignPushActionsWithOpts, but is sent using API.PushTransaction
+func (api *API) SignPushActionsWithOpts(actions []*eos.Action, opts *eos.TxOptions) (out *eos.PushTransactionFullResp, err error) {
+	if opts == nil {
+		opts = &eos.TxOptions{}
+	}
+	if err = opts.FillFromChain(api.API); err != nil {
+		return nil, err
+	}
+	return api.SignPushTransaction(eos.NewTransaction(actions, opts), opts.ChainID, opts.Compress)
+}
+
+// RetryPolicy sets which push errors SignPushActionsRetry treats as transient, and how long it waits between attempts.
+// The wait starts at InitialBackoff and doubles after each attempt, up to MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// RetryableErrors are the error names returned by nodeos that will be retried
+	RetryableErrors []string
+}
+
+// DefaultRetryPolicy retries expired and unknown reference block errors
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     4,
+	InitialBackoff:  500 * time.Millisecond,
+	MaxBackoff:      8 * time.Second,
+	RetryableErrors: []string{"expired_tx_exception", "unknown_block_exception"},
+}
+
+// ErrAlreadyApplied is returned by SignPushActionsRetry when the node reports the transaction as a duplicate, meaning
+// an earlier attempt was accepted. Check for it with errors.Is, the node's error is still available with errors.As.
+var ErrAlreadyApplied = errors.New("transaction was already applied")
+
+type alreadyAppliedError struct {
+	err error
+}
+
+func (e alreadyAppliedError) Error() string {
+	return ErrAlreadyApplied.Error() + ": " + e.err.Error()
+}
+
+func (e alreadyAppliedError) Unwrap() error {
+	return e.err
+}
+
+func (e alreadyAppliedError) Is(target error) bool {
+	return target == ErrAlreadyApplied
+}
+
+// isTxDuplicate checks if the node rejected a transaction because it has already seen it
+func isTxDuplicate(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.ErrorStruct.Name == "tx_duplicate"
+}
+
+// Retryable checks if the error is one of the RetryableErrors
+func (rp RetryPolicy) Retryable(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		return false
+	}
+	name := apiErr.ErrorStruct.Name
+	for _, r := range rp.RetryableErrors {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SignPushActionsRetry is the same as SignPushActions, but retries transient errors with exponential backoff
+// according to api.RetryPolicy. Each attempt builds a new transaction with a fresh reference block and expiration.
+// A duplicate transaction error is never retried, since signing again could apply the actions twice, ErrAlreadyApplied
+// is returned instead.
+func (api *API) SignPushActionsRetry(a ...*Action) (out *eos.PushTransactionFullResp, err error) {
+	policy := DefaultRetryPolicy
+	if api.RetryPolicy != nil {
+		policy = *api.RetryPolicy
+	}
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		out, err = api.SignPushActions(a...)
+		if isTxDuplicate(err) {
+			return nil, alreadyAppliedError{err: err}
+		}
+		if err == nil || attempt >= policy.MaxAttempts || !policy.Retryable(err) {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-api.doneChan():
+			return nil, ErrClosed
+		}
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package fio
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestAPI_GetCurrentBlock(t *testing.T) {
@@ -240,3 +248,426 @@ func TestAPI_GetTableByScopeMore(t *testing.T) {
 		t.Error("expected more records")
 	}
 }
+
+func TestParseChainTime(t *testing.T) {
+	const known = "2021-03-01T12:34:56.500000"
+	parsed, err := ParseChainTime(known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Location() != time.UTC || parsed.Nanosecond() != 500000000 || parsed.Unix() != 1614602096 {
+		t.Errorf("unexpected time %v", parsed)
+	}
+	if FormatChainTime(parsed) != known {
+		t.Errorf("round trip failed: %s", FormatChainTime(parsed))
+	}
+
+	for _, s := range []string{"2021-03-01T12:34:56", "2021-03-01T12:34:56.5", "2021-03-01T12:34:56.500Z", `"2021-03-01T12:34:56.500"`} {
+		got, err := ParseChainTime(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if got.Unix() != parsed.Unix() {
+			t.Errorf("%s parsed as %v", s, got)
+		}
+	}
+	if _, err = ParseChainTime("03/01/2021"); err == nil {
+		t.Error("expected error for invalid timestamp")
+	}
+	if exp, err := (FioName{Expiration: "2022-01-01T00:00:00"}).ExpirationTime(); err != nil || exp.Year() != 2022 {
+		t.Error("could not parse name expiration")
+	}
+
+	// requests and get_info use it too, eos.JSONTime would reject the trailing 'Z'
+	rs := RequestStatus{}
+	if err = json.Unmarshal([]byte(`{"fio_request_id":1,"time_stamp":"2021-03-01T12:34:56.500Z"}`), &rs); err != nil {
+		t.Fatal(err)
+	}
+	if rs.FioRequestId != 1 || rs.TimeStamp.Unix() != parsed.Unix() {
+		t.Errorf("request time_stamp did not decode: %+v", rs)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"chain_id":"%s","head_block_num":2,"head_block_time":"2021-03-01T12:34:56.500Z"}`, ChainIdTestnet)
+	}))
+	defer srv.Close()
+	api := &API{API: eos.New(srv.URL)}
+	info, err := api.GetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.HeadBlockTime.Unix() != parsed.Unix() || info.HeadBlockNum != 2 || info.ChainID.String() != ChainIdTestnet {
+		t.Errorf("get_info did not decode: %+v", info)
+	}
+}
+
+func TestAPI_Close(t *testing.T) {
+	var polls int32
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_pending_fio_requests" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		atomic.AddInt32(&polls, 1)
+		_, _ = w.Write([]byte(`{"requests":[{"fio_request_id":1},{"fio_request_id":2}],"more":0}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	before := runtime.NumGoroutine()
+	found, err := api.WatchPendingRequests("FIO5somebody", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 2; i++ {
+		if r := <-found; r.FioRequestId != i {
+			t.Errorf("expected request %d, got %d", i, r.FioRequestId)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&polls) < 2 {
+		t.Error("watcher did not keep polling")
+	}
+
+	if err = api.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, open := <-found:
+		if open {
+			t.Error("already seen requests should not be sent again")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("watcher did not stop after Close")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines leaked: %d before, %d after", before, after)
+	}
+
+	if _, err = api.GetInfo(); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+	if _, err = api.GetNftsContract("ETH", "0x123", "", 0, 10); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed from fio call after Close, got %v", err)
+	}
+	if _, err = api.WatchPendingRequests("FIO5somebody", time.Second); err != ErrClosed {
+		t.Errorf("expected ErrClosed starting a watcher after Close, got %v", err)
+	}
+	if err = api.Close(); err != nil {
+		t.Error("Close should be idempotent")
+	}
+}
+
+func TestAPI_ctxVariants(t *testing.T) {
+	release := make(chan struct{})
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chain/get_fio_balance":
+			_, _ = w.Write([]byte(`{"balance":1000000000,"available":1000000000,"staked":0,"srps":0,"roe":"1"}`))
+		case "/v1/chain/get_currency_balance":
+			_, _ = w.Write([]byte(`["2.500000000 FIO"]`))
+		case "/v1/chain/get_nfts_fio_address", "/v1/chain/get_nfts_hash", "/v1/chain/get_fio_names":
+			// simulate a node that never answers
+			<-release
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	// handlers must be released before the server can close
+	defer close(release)
+
+	ctx := context.Background()
+	if info, err := api.GetInfoCtx(ctx); err != nil || info.ChainID.String() != ChainIdTestnet {
+		t.Errorf("GetInfoCtx failed: %v", err)
+	}
+	if bal, err := api.GetFioBalanceCtx(ctx, "FIO5somebody"); err != nil || bal.Balance != Tokens(1) {
+		t.Errorf("GetFioBalanceCtx failed: %v", err)
+	}
+	if bal, err := api.GetBalanceCtx(ctx, "htjonrkf1lgs"); err != nil || bal != 2.5 {
+		t.Errorf("GetBalanceCtx failed: %v %f", err, bal)
+	}
+
+	for name, call := range map[string]func(ctx context.Context) error{
+		"GetNftsFioAddressCtx": func(ctx context.Context) error {
+			_, err := api.GetNftsFioAddressCtx(ctx, "alice@fiotestnet", 0, 10)
+			return err
+		},
+		"GetNftsHashCtx": func(ctx context.Context) error {
+			_, err := api.GetNftsHashCtx(ctx, "abc", 0, 10)
+			return err
+		},
+		"GetFioNamesCtx": func(ctx context.Context) error {
+			_, _, err := api.GetFioNamesCtx(ctx, "FIO5somebody")
+			return err
+		},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		err := call(ctx)
+		cancel()
+		if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+			t.Errorf("%s: expected deadline exceeded, got %v", name, err)
+		}
+		if time.Since(start) > time.Second {
+			t.Errorf("%s: did not return promptly after the deadline", name)
+		}
+	}
+}
+
+func TestAPI_SignPushActionsRetry(t *testing.T) {
+	var attempts int32
+	var failWith string
+	var failures int32
+	acc, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/push_transaction" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		n := atomic.AddInt32(&attempts, 1)
+		if n <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprintf(w, `{"code":500,"message":"Internal Service Error","error":{"code":3040005,"name":"%s","what":"failed","details":[]}}`, failWith)
+			return
+		}
+		_, _ = w.Write([]byte(`{"transaction_id":"00","processed":{"block_num":3}}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	api.RetryPolicy = &RetryPolicy{
+		MaxAttempts:     3,
+		InitialBackoff:  time.Millisecond,
+		MaxBackoff:      5 * time.Millisecond,
+		RetryableErrors: DefaultRetryPolicy.RetryableErrors,
+	}
+	transfer := NewTransferTokensPubKey(acc.Actor, acc.PubKey, Tokens(1))
+
+	failWith, failures = "expired_tx_exception", 2
+	if _, err = api.SignPushActionsRetry(transfer); err != nil {
+		t.Errorf("expected success after retries, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+
+	attempts, failWith, failures = 0, "unknown_block_exception", 5
+	if _, err = api.SignPushActionsRetry(transfer); err == nil {
+		t.Error("expected an error after exhausting attempts")
+	}
+	if attempts != 3 {
+		t.Errorf("expected MaxAttempts to be respected, got %d attempts", attempts)
+	}
+
+	attempts, failWith, failures = 0, "eosio_assert_message_exception", 5
+	if _, err = api.SignPushActionsRetry(transfer); err == nil {
+		t.Error("expected a non-retryable error")
+	}
+	if attempts != 1 {
+		t.Errorf("non-retryable error should not be retried, got %d attempts", attempts)
+	}
+
+	// a duplicate means an earlier push was accepted, signing again could apply the actions twice
+	attempts, failWith, failures = 0, "tx_duplicate", 5
+	api.RetryPolicy = nil
+	_, err = api.SignPushActionsRetry(transfer)
+	if !errors.Is(err, ErrAlreadyApplied) {
+		t.Errorf("expected ErrAlreadyApplied, got %v", err)
+	}
+	if _, ok := AsAPIError(err); !ok {
+		t.Error("node error should be available from ErrAlreadyApplied")
+	}
+	if attempts != 1 {
+		t.Errorf("duplicate transaction should only be pushed once, got %d pushes", attempts)
+	}
+}
+
+func TestAction_composeBuilders(t *testing.T) {
+	// builders from different files must return the same type so they can be pushed together
+	acc, _ := NewRandomAccount()
+	actions := []*Action{
+		NewTransferTokensPubKey(acc.Actor, acc.PubKey, Tokens(1)),
+		NewBpClaim("bp@fiotestnet", acc.Actor),
+		NewCancelFndReq(acc.Actor, 1),
+		NewPayTpidRewards(acc.Actor),
+	}
+	for _, a := range actions {
+		if a.ToEos().Account == "" {
+			t.Error("action did not convert to an eos.Action")
+		}
+	}
+}
+
+type countingTransport struct {
+	count int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.count, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// run with -race to check the API is safe for concurrent use
+func TestNewConnectionWithClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chain/get_info":
+			_, _ = fmt.Fprintf(w, `{"chain_id":"%s","head_block_num":2,"last_irreversible_block_num":1,"head_block_id":"%064x","head_block_time":"%s"}`,
+				ChainIdTestnet, 2, time.Now().UTC().Format("2006-01-02T15:04:05"))
+		case "/v1/chain/get_fio_balance":
+			req := getFioBalanceReq{}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			_, _ = fmt.Fprintf(w, `{"balance":%d,"available":%d}`, len(req.FioPublicKey), len(req.FioPublicKey))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	acc, err := NewRandomAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, _, err := NewConnectionWithClient(acc.KeyBag, srv.URL, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Transport != transport {
+		t.Error("the caller's client was modified")
+	}
+
+	before := atomic.LoadInt32(&transport.count)
+	const workers = 50
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			pub := strings.Repeat("x", i+1)
+			bal, e := api.GetFioBalance(pub)
+			if e == nil && bal.Balance != uint64(len(pub)) {
+				e = fmt.Errorf("got balance %d for %s, expected %d", bal.Balance, pub, len(pub))
+			}
+			if e == nil && i%10 == 0 {
+				api.SetTpid("tpid@wallet")
+				_ = api.Tpid()
+				_ = MaxFeesUpdated()
+			}
+			errs <- e
+		}(i)
+	}
+	for i := 0; i < workers; i++ {
+		if e := <-errs; e != nil {
+			t.Error(e)
+		}
+	}
+	if got := atomic.LoadInt32(&transport.count) - before; got != workers {
+		t.Errorf("expected %d requests through the supplied client, got %d", workers, got)
+	}
+}
+
+func TestAPI_ChainID(t *testing.T) {
+	var infoCalls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_info" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		n := atomic.AddInt32(&infoCalls, 1)
+		_, _ = fmt.Fprintf(w, `{"server_version":"abc123","chain_id":"%s","head_block_num":%d,"last_irreversible_block_num":%d,"head_block_id":"%064x","head_block_time":"%s"}`,
+			ChainIdTestnet, n+1, n, n+1, time.Now().UTC().Format("2006-01-02T15:04:05"))
+	}))
+	defer srv.Close()
+	acc, err := NewRandomAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, _, err := NewConnection(acc.KeyBag, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := atomic.LoadInt32(&infoCalls)
+	for i := 0; i < 3; i++ {
+		id, err := api.ChainID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.String() != ChainIdTestnet {
+			t.Errorf("got chain id %s", id.String())
+		}
+	}
+	if calls := atomic.LoadInt32(&infoCalls) - before; calls != 1 {
+		t.Errorf("expected the chain id to be requested once, got %d calls", calls)
+	}
+
+	info, err := api.GetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ServerVersion != "abc123" || info.HeadBlockNum != info.LastIrreversibleBlockNum+1 || info.HeadBlockTime.IsZero() {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
+
+func TestAPI_WaitForIrreversible(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	info, err := api.GetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = api.WaitForIrreversible(info.LastIrreversibleBlockNum+2, 5*time.Second); err != nil {
+		t.Error(err)
+	}
+	err = api.WaitForIrreversible(math.MaxUint32, 100*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+
+	// 5xx responses are retried, other failures are returned without waiting for the timeout
+	var calls int32
+	infoSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) > 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":400,"message":"bad request","error":{"name":"invalid"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer infoSrv.Close()
+	infoApi := &API{API: eos.New(infoSrv.URL)}
+	start := time.Now()
+	err = infoApi.WaitForIrreversible(1, time.Minute)
+	if apiErr, ok := AsAPIError(err); !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected the 400 to be returned, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 3 || time.Since(start) > 10*time.Second {
+		t.Errorf("expected two retries before the permanent error, got %d calls", atomic.LoadInt32(&calls))
+	}
+	if err = api.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = api.WaitForIrreversible(1, time.Minute); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	resp := &eos.PushTransactionFullResp{}
+	resp.Processed.BlockNum = 42
+	if PushedBlockNum(resp) != 42 || PushedBlockNum(nil) != 0 {
+		t.Error("wrong block number")
+	}
+}
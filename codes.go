@@ -0,0 +1,84 @@
+package fio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChainCode identifies a blockchain, for example in public address mappings, NFTs, and OBT content. Chain codes are
+// case-insensitive on-chain, but some queries are case-sensitive, so Normalize should be used before comparing.
+type ChainCode string
+
+// TokenCode identifies a token on a chain, see ChainCode
+type TokenCode string
+
+// MaxCodeLen is the longest chain or token code accepted by the FIO contracts
+const MaxCodeLen = 10
+
+// common chain codes
+const (
+	ChainBCH   ChainCode = "BCH"
+	ChainBNB   ChainCode = "BNB"
+	ChainBTC   ChainCode = "BTC"
+	ChainDOGE  ChainCode = "DOGE"
+	ChainEOS   ChainCode = "EOS"
+	ChainETH   ChainCode = "ETH"
+	ChainFIO   ChainCode = "FIO"
+	ChainLTC   ChainCode = "LTC"
+	ChainMATIC ChainCode = "MATIC"
+	ChainTRX   ChainCode = "TRX"
+	ChainXRP   ChainCode = "XRP"
+)
+
+// common token codes
+const (
+	TokenBTC  TokenCode = "BTC"
+	TokenDAI  TokenCode = "DAI"
+	TokenETH  TokenCode = "ETH"
+	TokenFIO  TokenCode = "FIO"
+	TokenUSDC TokenCode = "USDC"
+	TokenUSDT TokenCode = "USDT"
+)
+
+// Normalize trims whitespace and upper-cases the chain code
+func (c ChainCode) Normalize() ChainCode {
+	return ChainCode(strings.ToUpper(strings.TrimSpace(string(c))))
+}
+
+func (c ChainCode) String() string {
+	return string(c)
+}
+
+// Normalize trims whitespace and upper-cases the token code
+func (t TokenCode) Normalize() TokenCode {
+	return TokenCode(strings.ToUpper(strings.TrimSpace(string(t))))
+}
+
+func (t TokenCode) String() string {
+	return string(t)
+}
+
+// Validate checks the chain code is non-empty, upper-case alphanumeric, and no longer than MaxCodeLen
+func (c ChainCode) Validate() error {
+	return validateCode("chain", string(c))
+}
+
+// Validate checks the token code, see ChainCode.Validate
+func (t TokenCode) Validate() error {
+	return validateCode("token", string(t))
+}
+
+func validateCode(kind string, code string) error {
+	if code == "" {
+		return fmt.Errorf("%s code is empty", kind)
+	}
+	if len(code) > MaxCodeLen {
+		return fmt.Errorf("%s code %q is longer than %d characters", kind, code, MaxCodeLen)
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return fmt.Errorf("%s code %q must be upper-case letters and digits only", kind, code)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package fio
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestChainCode_Normalize(t *testing.T) {
+	if ChainCode(" eth").Normalize() != ChainETH || TokenCode("usdt ").Normalize() != TokenUSDT {
+		t.Error("codes were not normalized")
+	}
+
+	// the node's lookup is case-sensitive, only return results for an exact match
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		req := getNftsReq{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		resp := NftResponse{Nfts: make([]Nft, 0)}
+		if req.ChainCode == "ETH" || req.ChainCode == "wax" {
+			resp.Nfts = append(resp.Nfts, Nft{ChainCode: req.ChainCode, ContractAddress: req.ContractAddress})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	userInput := ChainCode("eth")
+	if _, err = api.GetNftsContract(string(userInput), "0x123", "", 0, 100); !errors.Is(err, ErrNftNotFound) {
+		t.Fatal("expected the mis-matched case to miss")
+	}
+	nfts, err := api.GetNftsContract(userInput.Normalize().String(), "0x123", "", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nfts.Nfts) != 1 {
+		t.Error("normalized chain code did not find the nft")
+	}
+	// records added with a lower-case chain code before normalization must still be reachable
+	if nfts, err = api.GetNftsContract("wax", "0x123", "", 0, 100); err != nil || len(nfts.Nfts) != 1 {
+		t.Errorf("legacy lower-case record was not found: %v", err)
+	}
+
+	add, err := NewAddNft("alice@fiotestnet", []NftToAdd{{ChainCode: " eth", ContractAddress: "0x123", TokenId: "1"}}, "htjonrkf1lgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cc := add.Data.(*addNft).Nfts[0].ChainCode; cc != "ETH" {
+		t.Errorf("addnft chain code was not normalized: %q", cc)
+	}
+	rem, err := NewRemNft("alice@fiotestnet", []NftToDelete{{ChainCode: "wax", ContractAddress: "0x123", TokenId: "1"}}, "htjonrkf1lgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cc := rem.Data.(*RemNft).Nfts[0].ChainCode; cc != "wax" {
+		t.Errorf("remnft should send the legacy chain code as given, got %q", cc)
+	}
+}
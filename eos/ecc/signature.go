@@ -81,6 +81,9 @@ func NewSignature(fromText string) (Signature, error) {
 		fromText = fromText[3:] // strip curve ID
 
 		sigbytes := base58.Decode(fromText)
+		if len(sigbytes) <= 4 {
+			return Signature{}, fmt.Errorf("invalid signature length")
+		}
 
 		content := sigbytes[:len(sigbytes)-4]
 		checksum := sigbytes[len(sigbytes)-4:]
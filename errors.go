@@ -0,0 +1,129 @@
+package fio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fioprotocol/fio-go/eos"
+	"net/http"
+	"strings"
+)
+
+// APIError is returned when a node responds with an error status. The embedded eos.APIError holds the nodeos error
+// code, name, and 'what' for contract assertions, FIO endpoints instead report a Type and a list of Fields.
+//
+// FIO endpoints previously returned an eos.APIError value, code using a type assertion such as err.(eos.APIError)
+// should use errors.As instead. Methods provided by eos-go, including the push_transaction calls, still return an
+// eos.APIError, so errors.As with an eos.APIError works for errors from either source, and AsAPIError converts
+// either to an *APIError.
+type APIError struct {
+	eos.APIError
+	Type   string          `json:"type"`
+	Fields []APIErrorField `json:"fields"`
+
+	// StatusCode is the HTTP status, and Body is the unparsed response
+	StatusCode int    `json:"-"`
+	Body       []byte `json:"-"`
+}
+
+// APIErrorField describes an invalid field in a request to a FIO endpoint
+type APIErrorField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Error string `json:"error"`
+}
+
+// newAPIError builds the error for an unsuccessful response. Not found responses without a body, and unknown key
+// errors for missing data, return eos.ErrNotFound.
+func newAPIError(statusCode int, body []byte) error {
+	apiErr := &APIError{StatusCode: statusCode, Body: body}
+	if err := json.Unmarshal(body, apiErr); err != nil {
+		if statusCode == http.StatusNotFound {
+			return eos.ErrNotFound
+		}
+		return apiErr
+	}
+	if apiErr.IsUnknownKeyError() {
+		return eos.ErrNotFound
+	}
+	// FIO endpoints don't include the code in the body
+	if apiErr.Code == 0 {
+		apiErr.Code = statusCode
+	}
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	if e.ErrorStruct.What != "" || len(e.ErrorStruct.Details) > 0 {
+		return e.APIError.Error()
+	}
+	msg := e.Message
+	if msg == "" {
+		msg = fmt.Sprintf("status code=%d, body=%s", e.StatusCode, string(e.Body))
+	}
+	for _, f := range e.Fields {
+		msg = fmt.Sprintf("%s: %s: %s", msg, f.Name, f.Error)
+	}
+	return msg
+}
+
+// Unwrap allows errors.As to match an eos.APIError
+func (e *APIError) Unwrap() error {
+	return e.APIError
+}
+
+// messages returns all of the text describing the error
+func (e *APIError) messages() []string {
+	m := []string{e.Message, e.ErrorStruct.What}
+	for _, d := range e.ErrorStruct.Details {
+		m = append(m, d.Message)
+	}
+	for _, f := range e.Fields {
+		m = append(m, f.Error)
+	}
+	return m
+}
+
+// AsAPIError finds an *APIError in the error chain, or converts an eos.APIError returned by requests made using
+// eos-go.
+func AsAPIError(err error) (*APIError, bool) {
+	apiErr := &APIError{}
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	eosErr := eos.APIError{}
+	if errors.As(err, &eosErr) {
+		return &APIError{APIError: eosErr, StatusCode: eosErr.Code}, true
+	}
+	eosErrPtr := &eos.APIError{}
+	if errors.As(err, &eosErrPtr) && eosErrPtr != nil {
+		return &APIError{APIError: *eosErrPtr, StatusCode: eosErrPtr.Code}, true
+	}
+	return nil, false
+}
+
+// IsNotFound checks if the error is caused by the node not finding the requested data, for example when there are
+// no pending requests for a key.
+func IsNotFound(err error) bool {
+	if errors.Is(err, eos.ErrNotFound) {
+		return true
+	}
+	apiErr, ok := AsAPIError(err)
+	return ok && (apiErr.StatusCode == http.StatusNotFound || apiErr.Code == http.StatusNotFound)
+}
+
+// IsInsufficientFunds checks if a transaction failed because the account can't cover the amount or fee
+func IsInsufficientFunds(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		return false
+	}
+	for _, m := range apiErr.messages() {
+		m = strings.ToLower(m)
+		if strings.Contains(m, "insufficient funds") || strings.Contains(m, "insufficient balance") ||
+			strings.Contains(m, "overdrawn balance") {
+			return true
+		}
+	}
+	return false
+}
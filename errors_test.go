@@ -0,0 +1,94 @@
+package fio
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/fioprotocol/fio-go/eos"
+)
+
+func TestAPIError(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chain/get_locks":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"No lock tokens in account"}`))
+		case "/v1/chain/get_fee":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"type":"invalid_input","message":"An invalid request was sent in, please check the nested errors for details.","fields":[{"name":"max_fee","value":"1","error":"Insufficient funds to cover fee"}]}`))
+		case "/v1/chain/get_block":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"code":500,"message":"Internal Service Error","error":{"code":3050003,"name":"eosio_assert_message_exception","what":"eosio_assert_message assertion failure","details":[{"message":"assertion failure with message: overdrawn balance"}]}}`))
+		case "/v1/chain/get_fio_balance":
+			_, _ = w.Write([]byte(`{"balance":`))
+		case "/v1/chain/get_producers":
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`<html>bad gateway</html>`))
+		case "/v1/chain/push_transaction":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"code":500,"message":"Internal Service Error","error":{"code":3050003,"name":"eosio_assert_message_exception","what":"eosio_assert_message assertion failure","details":[{"message":"assertion failure with message: Insufficient funds to cover fee"}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	_, err = api.GetLocks("FIO6LKbc")
+	if !IsNotFound(err) || IsInsufficientFunds(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	_, err = api.GetFee("alice@fiotestnet", FeeTransferTokensPubKey)
+	apiErr := &APIError{}
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %T", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Type != "invalid_input" || len(apiErr.Fields) != 1 || apiErr.Fields[0].Name != "max_fee" {
+		t.Errorf("unexpected error: %+v", apiErr)
+	}
+	if !IsInsufficientFunds(err) || IsNotFound(err) {
+		t.Error("expected insufficient funds")
+	}
+
+	_, err = api.GetBlockByNum(1)
+	eosErr := eos.APIError{}
+	if !errors.As(err, &eosErr) || eosErr.ErrorStruct.Name != "eosio_assert_message_exception" {
+		t.Errorf("expected the eos.APIError to be available, got %v", err)
+	}
+	if !IsInsufficientFunds(err) {
+		t.Error("expected insufficient funds from the assertion message")
+	}
+	if !IsInsufficientFunds(eosErr) || IsInsufficientFunds(errors.New("insufficient funds")) {
+		t.Error("IsInsufficientFunds should only match API errors")
+	}
+
+	_, err = api.GetFioBalance("FIO6LKbc")
+	syntaxErr := &json.SyntaxError{}
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected a json error, got %v", err)
+	}
+
+	_, err = api.GetProducers(10, 0)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || string(apiErr.Body) != `<html>bad gateway</html>` {
+		t.Errorf("expected the raw body, got %v", err)
+	}
+
+	// pushes are sent by eos-go, the same checks work for its errors
+	acc, _ := NewRandomAccount()
+	_, err = api.SignPushActions(NewTransferTokensPubKey(acc.Actor, acc.PubKey, Tokens(1)))
+	eosErr = eos.APIError{}
+	if !errors.As(err, &eosErr) || eosErr.ErrorStruct.Name != "eosio_assert_message_exception" {
+		t.Errorf("expected the eos.APIError from a push, got %v", err)
+	}
+	if converted, ok := AsAPIError(err); !ok || converted.ErrorStruct.Name != "eosio_assert_message_exception" {
+		t.Error("AsAPIError should convert an eos.APIError")
+	}
+	if !IsInsufficientFunds(err) {
+		t.Error("expected insufficient funds from a push")
+	}
+}
@@ -0,0 +1,175 @@
+package fio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fioprotocol/fio-go/eos"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// NewConnectionMulti is the same as NewConnection, but requests fail over across several nodes. Endpoints are tried in
+// order starting with the last one that answered, moving on when a node can't be reached or responds with a 502, 503,
+// or 504. A 500 is not retried because nodeos uses it to report failed transactions.
+func NewConnectionMulti(keyBag *eos.KeyBag, urls []string) (*API, *TxOptions, error) {
+	if len(urls) == 0 {
+		return &API{}, nil, errors.New("no urls provided")
+	}
+	ft := &failoverTransport{endpoints: make([]*url.URL, len(urls))}
+	for i := range urls {
+		u, err := url.Parse(strings.TrimSuffix(urls[i], "/"))
+		if err != nil {
+			return &API{}, nil, fmt.Errorf("invalid url %q: %v", urls[i], err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return &API{}, nil, fmt.Errorf("invalid url %q: scheme and host are required", urls[i])
+		}
+		ft.endpoints[i] = u
+	}
+	ft.base = ft.endpoints[0]
+	client := *eos.New(urls[0]).HttpClient
+	ft.next = client.Transport
+	client.Transport = ft
+	api, txOpts, err := NewConnectionWithClient(keyBag, ft.base.String(), &client)
+	if err != nil {
+		return api, txOpts, err
+	}
+	api.failover = ft
+	return api, txOpts, nil
+}
+
+// Endpoint returns the URL of the node requests are currently sent to
+func (api *API) Endpoint() string {
+	if api.failover == nil {
+		return api.BaseURL
+	}
+	return api.failover.endpoint(api.failover.currentIndex()).String()
+}
+
+// HealthCheck calls get_info on each endpoint in order and switches to the first one that answers, an error is
+// returned if none do. For connections with a single URL it only checks that node.
+func (api *API) HealthCheck(ctx context.Context) error {
+	if api.failover == nil {
+		_, err := api.GetInfoCtx(ctx)
+		return err
+	}
+	if api.isClosed() {
+		return ErrClosed
+	}
+	client := &http.Client{Transport: api.failover.next, Timeout: api.HttpClient.Timeout}
+	errs := make([]string, 0)
+	for i, u := range api.failover.endpoints {
+		err := checkEndpoint(ctx, client, u)
+		if err == nil {
+			api.failover.setCurrent(i)
+			return nil
+		}
+		errs = append(errs, err.Error())
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return fmt.Errorf("no healthy endpoints: %s", strings.Join(errs, "; "))
+}
+
+func checkEndpoint(ctx context.Context, client *http.Client, u *url.URL) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String()+"/v1/chain/get_info", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u.String(), resp.Status)
+	}
+	info := &eos.InfoResp{}
+	if err = json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return fmt.Errorf("%s: %v", u.String(), err)
+	}
+	return nil
+}
+
+// failoverTransport sends each request to the current endpoint, trying the others when it is unavailable
+type failoverTransport struct {
+	next      http.RoundTripper
+	base      *url.URL // requests are built against base, the scheme, host, and path prefix are replaced
+	endpoints []*url.URL
+
+	mux     sync.RWMutex
+	current int
+}
+
+func (ft *failoverTransport) currentIndex() int {
+	ft.mux.RLock()
+	defer ft.mux.RUnlock()
+	return ft.current
+}
+
+func (ft *failoverTransport) setCurrent(i int) {
+	ft.mux.Lock()
+	ft.current = i
+	ft.mux.Unlock()
+}
+
+func (ft *failoverTransport) endpoint(i int) *url.URL {
+	return ft.endpoints[i%len(ft.endpoints)]
+}
+
+// failoverStatus is true for responses that indicate the node, rather than the request, has a problem
+func failoverStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+func (ft *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := ft.currentIndex()
+	var lastErr error
+	for i := 0; i < len(ft.endpoints); i++ {
+		idx := (start + i) % len(ft.endpoints)
+		r := req.Clone(req.Context())
+		target := ft.endpoint(idx)
+		r.URL.Scheme, r.URL.Host, r.Host = target.Scheme, target.Host, ""
+		r.URL.Path = target.Path + strings.TrimPrefix(req.URL.Path, ft.base.Path)
+		if i > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				// the body can't be replayed
+				break
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		resp, err := ft.next.RoundTrip(r)
+		last := i == len(ft.endpoints)-1
+		switch {
+		case err == nil && (!failoverStatus(resp.StatusCode) || last):
+			if !failoverStatus(resp.StatusCode) {
+				ft.setCurrent(idx)
+			}
+			return resp, nil
+		case err == nil:
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s: %s", target.String(), resp.Status)
+		case req.Context().Err() != nil:
+			return nil, err
+		default:
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+func (ft *failoverTransport) CloseIdleConnections() {
+	if ci, ok := ft.next.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
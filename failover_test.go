@@ -0,0 +1,91 @@
+package fio
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFailoverNode(status *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code := atomic.LoadInt32(status); code != http.StatusOK {
+			w.WriteHeader(int(code))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/chain/get_info":
+			_, _ = fmt.Fprintf(w, `{"chain_id":"%s","head_block_num":2,"last_irreversible_block_num":1,"head_block_id":"%064x","head_block_time":"%s"}`,
+				ChainIdTestnet, 2, time.Now().UTC().Format("2006-01-02T15:04:05"))
+		case "/v1/chain/get_fio_balance":
+			_, _ = w.Write([]byte(`{"balance":1000000000,"available":1000000000}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestNewConnectionMulti(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadUrl := dead.URL
+	dead.Close()
+
+	liveStatus, backupStatus := int32(http.StatusOK), int32(http.StatusOK)
+	live := newFailoverNode(&liveStatus)
+	defer live.Close()
+	backup := newFailoverNode(&backupStatus)
+	defer backup.Close()
+
+	acc, err := NewRandomAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = NewConnectionMulti(acc.KeyBag, nil); err == nil {
+		t.Error("expected an error with no urls")
+	}
+
+	api, _, err := NewConnectionMulti(acc.KeyBag, []string{deadUrl, live.URL, backup.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if api.Endpoint() != live.URL {
+		t.Errorf("expected to fail over to %s, current endpoint is %s", live.URL, api.Endpoint())
+	}
+	bal, err := api.GetFioBalance(acc.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bal.Balance != 1000000000 {
+		t.Error("unexpected balance")
+	}
+
+	// a node that is up but unavailable is skipped
+	atomic.StoreInt32(&liveStatus, http.StatusServiceUnavailable)
+	if _, err = api.GetFioBalance(acc.PubKey); err != nil {
+		t.Fatal(err)
+	}
+	if api.Endpoint() != backup.URL {
+		t.Errorf("expected to fail over to %s, current endpoint is %s", backup.URL, api.Endpoint())
+	}
+
+	// health check prefers the earliest healthy endpoint
+	atomic.StoreInt32(&liveStatus, http.StatusOK)
+	if err = api.HealthCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if api.Endpoint() != live.URL {
+		t.Errorf("expected health check to select %s, current endpoint is %s", live.URL, api.Endpoint())
+	}
+
+	atomic.StoreInt32(&liveStatus, http.StatusServiceUnavailable)
+	atomic.StoreInt32(&backupStatus, http.StatusServiceUnavailable)
+	if err = api.HealthCheck(context.Background()); err == nil {
+		t.Error("expected health check to fail with no healthy endpoints")
+	}
+	if _, err = api.GetFioBalance(acc.PubKey); err == nil {
+		t.Error("expected an error when every endpoint is down")
+	}
+}
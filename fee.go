@@ -1,14 +1,20 @@
 package fio
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
-	"io/ioutil"
+	"github.com/shopspring/decimal"
+	"math"
+	"reflect"
+	"strconv"
 	"sync"
+	"time"
 )
 
 const (
+	FeeAddBundles           = "add_bundled_transactions"
 	FeeAddNft               = "add_nft"
 	FeeAddPubAddress        = "add_pub_address"
 	FeeAuthDelete           = "auth_delete"
@@ -38,6 +44,7 @@ const (
 	FeeRenewFioAddress      = "renew_fio_address"
 	FeeRenewFioDomain       = "renew_fio_domain"
 	FeeSetDomainPub         = "set_fio_domain_public"
+	FeeStakeFio             = "stake_fio_tokens"
 	FeeSubmitFeeMult        = "submit_fee_multiplier"
 	FeeSubmitFeeVote        = "submit_fee_ratios"
 	FeeTransferAddress      = "transfer_fio_address"
@@ -46,6 +53,7 @@ const (
 	FeeTransferTokensPubKey = "transfer_tokens_pub_key"
 	FeeUnregisterProducer   = "unregister_producer"
 	FeeUnregisterProxy      = "unregister_proxy"
+	FeeUnstakeFio           = "unstake_fio_tokens"
 	FeeVoteProducer         = "vote_producer"
 )
 
@@ -56,6 +64,7 @@ var (
 	// *IMPORTANT:* After performing fee updates call `api.RefreshFees` to refresh values from the on-chain tables.
 	//  maxFees are _default_ values: fees are automatically updated on first connect on a best-effort basis.
 	maxFees = map[string]float64{
+		"add_bundled_transactions":    2.0,
 		"add_pub_address":             0.4,
 		"add_nft":                     0.4,
 		"add_to_whitelist":            0.0,
@@ -90,13 +99,16 @@ var (
 		"submit_fee_ratios":           0.4,
 		"submit_fee_vote":             0.4, // outdated endpoint, not longer used.
 		"set_fio_domain_public":       0.4,
+		"stake_fio_tokens":            3.0,
 		"submit_bundled_transaction":  0.4,
 		"transfer_fio_address":        1.0,
 		"transfer_fio_domain":         1.0,
 		"transfer_tokens_fio_address": 0.1,
 		"transfer_locked_tokens":      2.0,
 		"transfer_tokens_pub_key":     2.0,
+		"unregister_producer":         0.4,
 		"unregister_proxy":            0.4,
+		"unstake_fio_tokens":          3.0,
 		"vote_producer":               0.4,
 	}
 
@@ -104,6 +116,7 @@ var (
 	// slight chance fee will be wrong if there are two actions with identical name, but don't think there are any cases
 	// where that will happen right now.
 	maxFeesByAction = map[string]string{
+		"addbundles":   FeeAddBundles,
 		"addnft":       FeeAddNft,
 		"addaddress":   FeeAddPubAddress,
 		"approve":      FeeMsigApprove,
@@ -132,11 +145,13 @@ var (
 		"setdomainpub": FeeSetDomainPub,
 		"setfeemult":   FeeSubmitFeeMult,
 		"setfeevote":   FeeSubmitFeeVote,
+		"stakefio":     FeeStakeFio,
 		"trnsfiopubky": FeeTransferTokensPubKey,
 		"trnsloctoks":  FeeTransferLockedTokens,
 		"unapprove":    FeeMsigUnapprove,
 		"unregprod":    FeeUnregisterProducer,
 		"unregproxy":   FeeUnregisterProxy,
+		"unstakefio":   FeeUnstakeFio,
 		"updateauth":   FeeAuthUpdate,
 		"voteproducer": FeeVoteProducer,
 		"voteproxy":    FeeProxyVote,
@@ -159,32 +174,62 @@ func UpdateMaxFees(api *API) bool {
 // RefreshFees refreshes the maxFees map from the on-chain table. This is automatically called
 // by NewConnection if fees are not already up-to-date.
 func (api *API) RefreshFees() bool {
-	fees, err := api.GetTableRows(eos.GetTableRowsRequest{
-		Code:  "fio.fee",
-		Scope: "fio.fee",
-		Table: "fiofees",
-		Limit: 100,
-		JSON:  true,
-	})
-	if err != nil {
-		return false
-	}
-	results := make([]FioFee, 0)
-	err = json.Unmarshal(fees.Rows, &results)
+	results, err := api.GetFeesTable()
 	if err != nil {
 		return false
 	}
 	maxFeeMutex.Lock()
 	for _, f := range results {
-		maxFees[f.EndPoint] = float64(f.SufAmount) / 1000000000.0
+		maxFees[f.EndPoint] = FromTokens(f.SufAmount)
 	}
-	maxFeeMutex.Unlock()
 	maxFeesUpdated = true
+	maxFeeMutex.Unlock()
 	return true
 }
 
+// GetFeesTable reads every row of the fio.fee fiofees table
+func (api *API) GetFeesTable() ([]FioFee, error) {
+	results := make([]FioFee, 0)
+	lower := ""
+	for {
+		fees, err := api.GetTableRows(eos.GetTableRowsRequest{
+			Code:       "fio.fee",
+			Scope:      "fio.fee",
+			Table:      "fiofees",
+			LowerBound: lower,
+			Limit:      100,
+			JSON:       true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		page := make([]FioFee, 0)
+		if err = json.Unmarshal(fees.Rows, &page); err != nil {
+			return nil, err
+		}
+		results = append(results, page...)
+		if !fees.More || len(page) == 0 {
+			return results, nil
+		}
+		lower = strconv.FormatUint(page[len(page)-1].FeeId+1, 10)
+	}
+}
+
+// LookupMaxFee is the same as GetMaxFee, but returns an error if the fee is not known instead of silently returning
+// zero, which would guarantee the transaction is rejected. Builders that return an error use this.
+func LookupMaxFee(name string) (fioTokens float64, err error) {
+	maxFeeMutex.RLock()
+	fioTokens, ok := maxFees[name]
+	maxFeeMutex.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("no max fee is known for %q, try calling api.RefreshFees()", name)
+	}
+	return fioTokens, nil
+}
+
 // GetMaxFee looks up a fee from the map, this is based on the values in the fiofees table, and does not take into
-// account any bundled transactions for the user, use GetFee() for that.
+// account any bundled transactions for the user, use GetFee() for that. An unknown fee returns zero, use
+// LookupMaxFee to detect this.
 func GetMaxFee(name string) (fioTokens float64) {
 	maxFeeMutex.RLock()
 	fioTokens = maxFees[name]
@@ -192,6 +237,45 @@ func GetMaxFee(name string) (fioTokens float64) {
 	return fioTokens
 }
 
+// EstimateOnboardingCost gives the total of the maximum fees (in SUFs) for a new user to get started: registering
+// a FIO address, and optionally a domain. Registering an address includes a set of bundled transactions, so buying
+// another set is only included if includeBundles is set. If the fees have not been loaded from the chain yet an
+// attempt is made to refresh them first.
+func (api *API) EstimateOnboardingCost(includeDomain bool, includeBundles bool) (uint64, error) {
+	breakdown, err := api.EstimateOnboardingBreakdown(includeDomain, includeBundles)
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, fee := range breakdown {
+		total += fee
+	}
+	return total, nil
+}
+
+// EstimateOnboardingBreakdown returns the fees included in EstimateOnboardingCost keyed by the fee's endpoint name.
+func (api *API) EstimateOnboardingBreakdown(includeDomain bool, includeBundles bool) (map[string]uint64, error) {
+	if !MaxFeesUpdated() {
+		_ = api.RefreshFees()
+	}
+	needed := []string{FeeRegisterFioAddress}
+	if includeDomain {
+		needed = append(needed, FeeRegisterFioDomain)
+	}
+	if includeBundles {
+		needed = append(needed, FeeAddBundles)
+	}
+	breakdown := make(map[string]uint64)
+	for _, name := range needed {
+		fee, err := LookupMaxFee(name)
+		if err != nil {
+			return nil, err
+		}
+		breakdown[name] = Tokens(fee)
+	}
+	return breakdown, nil
+}
+
 // GetMaxFeeByAction allows getting a fee given the contract action name instead of the API endpoint name.
 func GetMaxFeeByAction(name string) (fioTokens float64) {
 	maxFeeMutex.RLock()
@@ -215,29 +299,115 @@ type GetFeeResponse struct {
 // It is an API member function because it is neither tied to the current user, and is not a signed tx.
 // To get the actual fee schedule for an transaction use GetMaxFee() or GetMaxFeeByAction()
 func (api *API) GetFee(fioAddress string, endPoint string) (fee uint64, err error) {
-	j, err := json.Marshal(&GetFeeRequest{FioAddress: fioAddress, EndPoint: endPoint})
+	feeResp := &GetFeeResponse{}
+	err = api.call("chain", "get_fee", &GetFeeRequest{FioAddress: fioAddress, EndPoint: endPoint}, feeResp)
 	if err != nil {
 		return 0, err
 	}
-	resp, err := api.HttpClient.Post(api.BaseURL+"/v1/chain/get_fee", "application/json", bytes.NewReader(j))
-	if err != nil {
-		return 0, err
+	return feeResp.Fee, nil
+}
+
+// WithMaxFee overrides the max_fee the builder copied from the fee table, an error is returned if the action does
+// not have a max fee.
+func (act *Action) WithMaxFee(fee uint64) (*Action, error) {
+	if err := eos.CheckUnderOver(fee); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
-	f, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
+	ok := act.setDataField("MaxFee", func(f reflect.Value) bool {
+		switch f.Kind() {
+		case reflect.Uint64:
+			f.SetUint(fee)
+		case reflect.Int64:
+			f.SetInt(int64(fee))
+		default:
+			return false
+		}
+		return true
+	})
+	if !ok {
+		return nil, errors.New("action does not have a max fee")
 	}
-	feeResp := &GetFeeResponse{}
-	err = json.Unmarshal(f, feeResp)
+	return act, nil
+}
+
+// WithLiveFee replaces the max_fee on an action with the actual fee for fioAddress from get_fee, which is zero when
+// the action is covered by the address' bundled transactions. get_fee returns the price of a single bundle set, so
+// for addbundles it is multiplied by BundleSets.
+func (api *API) WithLiveFee(act *Action, fioAddress string) (*Action, error) {
+	if act == nil {
+		return nil, errors.New("nil action")
+	}
+	maxFeeActionMutex.RLock()
+	endPoint, ok := maxFeesByAction[string(act.Name)]
+	maxFeeActionMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no fee endpoint is known for action %s", act.Name)
+	}
+	fee, err := api.GetFee(fioAddress, endPoint)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return feeResp.Fee, nil
+	var sets int64
+	switch ab := act.Data.(type) {
+	case AddBundles:
+		sets = ab.BundleSets
+	case *AddBundles:
+		sets = ab.BundleSets
+	}
+	if sets > 1 {
+		if fee > math.MaxUint64/uint64(sets) {
+			return nil, fmt.Errorf("fee for %d bundle sets overflows", sets)
+		}
+		fee *= uint64(sets)
+	}
+	return act.WithMaxFee(fee)
+}
+
+// EstimateFees totals the max_fee of each action, for showing the cost of a transaction before it is sent. Actions
+// without a max fee (such as privileged actions) count as zero. The max fee is the worst case: call WithLiveFee on
+// actions first to use the actual fee, which is zero when covered by bundled transactions.
+func (api *API) EstimateFees(actions ...*Action) (total uint64, err error) {
+	for _, act := range actions {
+		fee, _ := act.maxFee()
+		if total+fee < total {
+			return 0, errors.New("fee total overflows")
+		}
+		total += fee
+	}
+	return total, eos.CheckUnderOver(total)
+}
+
+// maxFee reads the MaxFee field of the action data, if it has one
+func (act *Action) maxFee() (uint64, bool) {
+	if act == nil || act.Data == nil {
+		return 0, false
+	}
+	v := reflect.ValueOf(act.Data)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	f := v.FieldByName("MaxFee")
+	switch {
+	case !f.IsValid():
+		return 0, false
+	case f.Kind() == reflect.Uint64:
+		return f.Uint(), true
+	case f.Kind() == reflect.Int64 && f.Int() >= 0:
+		return uint64(f.Int()), true
+	}
+	return 0, false
 }
 
 // MaxFeesUpdated checks if the fee map has been updated, or if using the default (possibly wrong) values
 func MaxFeesUpdated() bool {
+	maxFeeMutex.RLock()
+	defer maxFeeMutex.RUnlock()
 	return maxFeesUpdated
 }
 
@@ -389,3 +559,122 @@ type BundleVoter struct {
 	BundleVoteNumber  int64           `json:"bundlevotenumber"`
 	LastVoteTimestamp uint64          `json:"lastvotetimestamp"`
 }
+
+// ProducerFeeVotes is a block producer's current fee vote, combining the base fee ratios from the feevotes2 table
+// and the multiplier from the feevoters table.
+type ProducerFeeVotes struct {
+	Producer        eos.AccountName `json:"producer"`
+	Multiplier      float64         `json:"multiplier"`
+	MultiplierVoted time.Time       `json:"multiplier_voted"`
+	Ratios          []FeeValue      `json:"ratios"`
+	RatiosVoted     time.Time       `json:"ratios_voted"`
+	HasMultiplier   bool            `json:"has_multiplier"`
+	HasRatios       bool            `json:"has_ratios"`
+}
+
+// Computed applies the multiplier to each of the voted ratios, giving the fee (in SUFs) the producer is voting for.
+func (pfv ProducerFeeVotes) Computed() []FeeValue {
+	mult := decimal.NewFromFloat(pfv.Multiplier)
+	fees := make([]FeeValue, len(pfv.Ratios))
+	for i, r := range pfv.Ratios {
+		fees[i] = FeeValue{
+			EndPoint: r.EndPoint,
+			Value:    decimal.NewFromInt(r.Value).Mul(mult).IntPart(),
+		}
+	}
+	return fees
+}
+
+// feeVoterRow and feeVotes2Row handle the string-encoded numeric types nodeos may return
+type feeVoterRow struct {
+	BlockProducerName eos.AccountName `json:"block_producer_name"`
+	FeeMultiplier     eos.JSONFloat64 `json:"fee_multiplier"`
+	LastVoteTimestamp eos.Uint64      `json:"lastvotetimestamp"`
+}
+
+type feeValueTsRow struct {
+	EndPoint  string     `json:"end_point"`
+	Value     eos.Int64  `json:"value"`
+	TimeStamp eos.Uint64 `json:"timestamp"`
+}
+
+type feeVotes2Row struct {
+	BlockProducerName eos.AccountName `json:"block_producer_name"`
+	FeeVotes          []feeValueTsRow `json:"feevotes"`
+	LastVoteTimestamp eos.Uint64      `json:"lastvotetimestamp"`
+}
+
+// parseFeeVotes fills the ProducerFeeVotes from the raw rows of the feevoters and feevotes2 tables.
+func (pfv *ProducerFeeVotes) parseFeeVotes(voterRows json.RawMessage, voteRows json.RawMessage) error {
+	voters := make([]feeVoterRow, 0)
+	if len(voterRows) > 0 {
+		if err := json.Unmarshal(voterRows, &voters); err != nil {
+			return err
+		}
+	}
+	for _, v := range voters {
+		if v.BlockProducerName != pfv.Producer {
+			continue
+		}
+		pfv.HasMultiplier = true
+		pfv.Multiplier = float64(v.FeeMultiplier)
+		pfv.MultiplierVoted = time.Unix(int64(v.LastVoteTimestamp), 0).UTC()
+	}
+
+	votes := make([]feeVotes2Row, 0)
+	if len(voteRows) > 0 {
+		if err := json.Unmarshal(voteRows, &votes); err != nil {
+			return err
+		}
+	}
+	pfv.Ratios = make([]FeeValue, 0)
+	for _, v := range votes {
+		if v.BlockProducerName != pfv.Producer {
+			continue
+		}
+		pfv.HasRatios = true
+		pfv.RatiosVoted = time.Unix(int64(v.LastVoteTimestamp), 0).UTC()
+		for _, fv := range v.FeeVotes {
+			pfv.Ratios = append(pfv.Ratios, FeeValue{EndPoint: fv.EndPoint, Value: int64(fv.Value)})
+		}
+	}
+	return nil
+}
+
+// GetFeeVotes returns a block producer's current fee ratio and multiplier votes. Use ProducerFeeVotes.Computed
+// to see the resulting fees.
+func (api *API) GetFeeVotes(producer string) (*ProducerFeeVotes, error) {
+	voter, err := api.GetTableRows(eos.GetTableRowsRequest{
+		Code:       "fio.fee",
+		Scope:      "fio.fee",
+		Table:      "feevoters",
+		LowerBound: producer,
+		UpperBound: producer,
+		KeyType:    "name",
+		Index:      "1",
+		Limit:      1,
+		JSON:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	votes, err := api.GetTableRows(eos.GetTableRowsRequest{
+		Code:       "fio.fee",
+		Scope:      "fio.fee",
+		Table:      "feevotes2",
+		LowerBound: producer,
+		UpperBound: producer,
+		KeyType:    "name",
+		Index:      "2",
+		Limit:      1,
+		JSON:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pfv := &ProducerFeeVotes{Producer: eos.AccountName(producer)}
+	if err = pfv.parseFeeVotes(voter.Rows, votes.Rows); err != nil {
+		return nil, err
+	}
+	return pfv, nil
+}
@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
+	"github.com/fioprotocol/fio-go/eos/ecc"
 	"math"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestUpdateMaxFees(t *testing.T) {
@@ -181,3 +185,256 @@ func Test_NewSubmitMultiplier(t *testing.T) {
 	}
 
 }
+
+func TestLookupMaxFee(t *testing.T) {
+	// every action with a known fee should have a default, otherwise builders will send a zero max_fee
+	maxFeeActionMutex.RLock()
+	for action, endpoint := range maxFeesByAction {
+		if _, err := LookupMaxFee(endpoint); err != nil {
+			t.Errorf("no default fee for action %s: %v", action, err)
+		}
+	}
+	maxFeeActionMutex.RUnlock()
+
+	// simulate a missing fee and ensure builders that return an error report it
+	maxFeeMutex.Lock()
+	saved := make(map[string]float64)
+	missing := []string{
+		FeeAddNft, FeeMsigPropose, FeeAuthUpdate, FeeRemovePubAddress, FeeRemoveAllAddresses,
+		FeeStakeFio, FeeUnstakeFio, FeeAddBundles,
+	}
+	for _, name := range missing {
+		saved[name] = maxFees[name]
+		delete(maxFees, name)
+	}
+	maxFeeMutex.Unlock()
+	defer func() {
+		maxFeeMutex.Lock()
+		for name, fee := range saved {
+			maxFees[name] = fee
+		}
+		maxFeeMutex.Unlock()
+	}()
+
+	_, err := NewAddNft("test@fiotestnet", []NftToAdd{{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "1"}}, "aftyershcu22")
+	if err == nil {
+		t.Error("expected an error when the fee could not be found")
+	}
+	acc, _ := NewRandomAccount()
+	pub, _ := ecc.NewPublicKey(acc.PubKey)
+	_, err = NewUpdateAuth(acc.Actor, "active", "owner", Authority{Threshold: 1, Keys: []KeyWeight{{PublicKey: pub, Weight: 1}}})
+	if err == nil {
+		t.Error("NewUpdateAuth: expected an error when the fee could not be found")
+	}
+	_, err = (&API{}).NewSignedMsigPropose("noop", []string{"aftyershcu22"}, []*Action{NewPayTpidRewards(acc.Actor)}, time.Hour, acc, &TxOptions{})
+	if err == nil || !strings.Contains(err.Error(), FeeMsigPropose) {
+		t.Error("NewSignedMsigPropose: expected an error when the fee could not be found, got", err)
+	}
+	_, err = NewRemoveAddrReq("test@fiotestnet", []TokenPubAddr{{TokenCode: "BTC", ChainCode: "BTC", PublicAddress: "1abc"}}, acc.Actor)
+	if err == nil {
+		t.Error("NewRemoveAddrReq: expected an error when the fee could not be found")
+	}
+	_, err = NewRemoveAllAddrReq("test@fiotestnet", acc.Actor)
+	if err == nil {
+		t.Error("NewRemoveAllAddrReq: expected an error when the fee could not be found")
+	}
+	_, err = NewStakeFio(acc.Actor, "", Tokens(1))
+	if err == nil {
+		t.Error("NewStakeFio: expected an error when the fee could not be found")
+	}
+	_, err = NewUnStakeFio(acc.Actor, "", Tokens(1))
+	if err == nil {
+		t.Error("NewUnStakeFio: expected an error when the fee could not be found")
+	}
+	_, err = NewAddBundledTransactions(acc.Actor, "test@fiotestnet", 1)
+	if err == nil {
+		t.Error("NewAddBundledTransactions: expected an error when the fee could not be found")
+	}
+}
+
+func TestProducerFeeVotes_parse(t *testing.T) {
+	const voters = `[{"block_producer_name":"qbxn5zhw2ypw","fee_multiplier":"1.50000000000000000","lastvotetimestamp":1612000000}]`
+	const votes = `[{"id":3,"block_producer_name":"qbxn5zhw2ypw","feevotes":[{"end_point":"register_fio_domain","value":"400000000000","timestamp":1612000100},{"end_point":"add_nft","value":200000000,"timestamp":1612000100}],"lastvotetimestamp":"1612000100"}]`
+	pfv := &ProducerFeeVotes{Producer: "qbxn5zhw2ypw"}
+	if err := pfv.parseFeeVotes([]byte(voters), []byte(votes)); err != nil {
+		t.Fatal(err)
+	}
+	if !pfv.HasMultiplier || pfv.Multiplier != 1.5 || pfv.MultiplierVoted.Unix() != 1612000000 {
+		t.Errorf("multiplier did not decode: %+v", pfv)
+	}
+	if !pfv.HasRatios || len(pfv.Ratios) != 2 || pfv.Ratios[0].Value != 400_000_000_000 || pfv.RatiosVoted.Unix() != 1612000100 {
+		t.Errorf("fee votes did not decode: %+v", pfv)
+	}
+	computed := pfv.Computed()
+	if computed[0].Value != 600_000_000_000 || computed[1].Value != 300_000_000 {
+		t.Errorf("computed fees were wrong: %+v", computed)
+	}
+}
+
+func TestAPI_EstimateOnboardingCost(t *testing.T) {
+	api := &API{API: eos.New("http://127.0.0.1:1")}
+	address, bundles, domain := Tokens(GetMaxFee(FeeRegisterFioAddress)), Tokens(GetMaxFee(FeeAddBundles)), Tokens(GetMaxFee(FeeRegisterFioDomain))
+	total, err := api.EstimateOnboardingCost(true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != address+domain {
+		t.Error("onboarding cost with domain did not match individual fees")
+	}
+	breakdown, err := api.EstimateOnboardingBreakdown(true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breakdown) != 2 || breakdown[FeeRegisterFioAddress] != address || breakdown[FeeRegisterFioDomain] != domain {
+		t.Errorf("unexpected breakdown: %v", breakdown)
+	}
+	total, err = api.EstimateOnboardingCost(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != address {
+		t.Error("onboarding cost without domain did not match the address fee")
+	}
+	if breakdown, _ = api.EstimateOnboardingBreakdown(false, false); breakdown[FeeRegisterFioDomain] != 0 || breakdown[FeeAddBundles] != 0 {
+		t.Error("domain and bundle fees should not be included")
+	}
+
+	// buying another set of bundles is optional, regaddress already grants the first set
+	total, err = api.EstimateOnboardingCost(true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != address+domain+bundles {
+		t.Error("onboarding cost with bundles did not match individual fees")
+	}
+	if breakdown, _ = api.EstimateOnboardingBreakdown(false, true); len(breakdown) != 2 || breakdown[FeeAddBundles] != bundles {
+		t.Errorf("unexpected breakdown with bundles: %v", breakdown)
+	}
+}
+
+func TestAPI_WithLiveFee(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_fee" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := &GetFeeRequest{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+		switch {
+		case req.FioAddress == "ada@dapixdev" && req.EndPoint == FeeAddPubAddress:
+			_, _ = w.Write([]byte(`{"fee":0}`))
+		case req.FioAddress == "ada@dapixdev" && req.EndPoint == FeeRenewFioAddress:
+			_, _ = w.Write([]byte(`{"fee":40000000000}`))
+		case req.FioAddress == "ada@dapixdev" && req.EndPoint == FeeAddBundles:
+			_, _ = w.Write([]byte(`{"fee":2000000000}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"type":"invalid_input","message":"An invalid request was sent in, please check the nested errors for details.","fields":[{"name":"fio_address","value":"","error":"FIO Address not found"}]}`))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	fee, err := api.GetFee("bob@dapixdev", FeeAddPubAddress)
+	if err == nil {
+		t.Errorf("an error response should not be reported as a fee of %d", fee)
+	}
+
+	add, _ := NewAddAddress("htjonrkf1lgs", "ada@dapixdev", "ETH", "ETH", "0xdeadbeef")
+	add, err = api.WithLiveFee(add, "ada@dapixdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if add.Data.(AddAddress).MaxFee != 0 {
+		t.Error("bundled action should have a zero max fee")
+	}
+	renew, err := api.WithLiveFee(NewRenewAddress("htjonrkf1lgs", "ada@dapixdev"), "ada@dapixdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renew.Data.(RenewAddress).MaxFee != 40000000000 {
+		t.Errorf("unexpected max fee %d", renew.Data.(RenewAddress).MaxFee)
+	}
+	// get_fee is for a single set of bundles
+	bundles, err := NewAddBundledTransactions("htjonrkf1lgs", "ada@dapixdev", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundles, err = api.WithLiveFee(bundles, "ada@dapixdev"); err != nil {
+		t.Fatal(err)
+	}
+	if bundles.Data.(AddBundles).MaxFee != 3*2000000000 {
+		t.Errorf("addbundles max fee should cover every set, got %d", bundles.Data.(AddBundles).MaxFee)
+	}
+	if _, err = api.WithLiveFee(NewPayTpidRewards("htjonrkf1lgs"), "ada@dapixdev"); err == nil {
+		t.Error("expected an error for an action without a fee endpoint")
+	}
+	if _, err = NewPayTpidRewards("htjonrkf1lgs").WithMaxFee(1); err == nil {
+		t.Error("expected an error for an action without a max fee")
+	}
+}
+
+func TestAPI_EstimateFees(t *testing.T) {
+	api := &API{}
+	renew := NewRenewAddress("htjonrkf1lgs", "ada@dapixdev")
+	add, _ := NewAddAddress("htjonrkf1lgs", "ada@dapixdev", "ETH", "ETH", "0xdeadbeef")
+	bundled, _ := NewAddAddress("htjonrkf1lgs", "ada@dapixdev", "BTC", "BTC", "bc1q")
+	bundled, _ = bundled.WithMaxFee(0)
+
+	total, err := api.EstimateFees(renew, add, bundled, NewPayTpidRewards("htjonrkf1lgs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Tokens(GetMaxFee(FeeRenewFioAddress)) + Tokens(GetMaxFee(FeeAddPubAddress))
+	if total != want {
+		t.Errorf("expected %d, got %d", want, total)
+	}
+	if total, _ = api.EstimateFees(); total != 0 {
+		t.Error("no actions should cost nothing")
+	}
+	huge, _ := renew.WithMaxFee(math.MaxInt64)
+	if _, err = api.EstimateFees(huge, add); err == nil {
+		t.Error("expected an error when the total is out of range")
+	}
+}
+
+func TestAPI_GetFeesTable(t *testing.T) {
+	var calls int
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_table_rows" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := &eos.GetTableRowsRequest{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+		if req.Code != "fio.fee" || req.Table != "fiofees" || !req.JSON {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		calls++
+		if req.LowerBound == "" {
+			_, _ = w.Write([]byte(`{"rows":[{"fee_id":0,"end_point":"register_fio_domain","suf_amount":800000000000}],"more":true}`))
+			return
+		}
+		if req.LowerBound != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"rows":[{"fee_id":1,"end_point":"register_fio_address","suf_amount":40000000000}],"more":false}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	calls = 0
+	fees, err := api.GetFeesTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || len(fees) != 2 || fees[1].EndPoint != "register_fio_address" || fees[1].SufAmount != 40000000000 {
+		t.Errorf("unexpected fees after %d calls: %+v", calls, fees)
+	}
+}
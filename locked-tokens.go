@@ -259,6 +259,10 @@ func NewTransferLockedTokens(actor eos.AccountName, recipientPubKey string, canV
 
 // NewValidTransferLockedTokens is the same as NewTransferLockedTokens, but adds checks to ensure the account does not exist, and the periods are legit
 func (api *API) NewValidTransferLockedTokens(actor eos.AccountName, recipientPubKey string, canVote bool, periods []LockPeriods, amount uint64) (*Action, error) {
+	fee, err := LookupMaxFee(FeeTransferLockedTokens)
+	if err != nil {
+		return nil, err
+	}
 	can := CanVoteNone
 	if canVote {
 		can = CanVoteAll
@@ -268,7 +272,7 @@ func (api *API) NewValidTransferLockedTokens(actor eos.AccountName, recipientPub
 		CanVote:        can,
 		Periods:        periods,
 		Amount:         amount,
-		MaxFee:         Tokens(GetMaxFee(FeeTransferLockedTokens)),
+		MaxFee:         Tokens(fee),
 		Actor:          actor,
 		Tpid:           CurrentTpid(),
 	}
@@ -286,26 +290,100 @@ func (tlt *TransferLockedTokens) valid(api *API) error {
 		return eos.CheckUnderOver(tlt.Amount)
 	case tlt.Amount == 0:
 		return errors.New("must transfer a positive amount")
-	case tlt.CanVote > CanVoteAll:
+	case tlt.CanVote < CanVoteNone || tlt.CanVote > CanVoteAll:
 		return errors.New("invalid value for can_vote, must be 0 or 1")
-	case len(tlt.Periods) == 0:
-		return errors.New("no periods provided")
+	}
+	if err := validLockPeriods(tlt.Periods); err != nil {
+		return err
 	}
 	act, err := ActorFromPub(tlt.PayeePublicKey)
 	if err != nil {
 		return err
 	}
+	_, err = api.GetAccountBalance(act)
+	switch err {
+	case ErrAccountNotFound:
+		return nil
+	case nil:
+		return errors.New("cannot transfer to an existing account")
+	}
+	return err
+}
+
+// AddLocked creates a genesis lock (see the Locked* grant types) for an account. This is a privileged action
+// requiring the eosio account's authority, and is only useful on development and test networks.
+type AddLocked struct {
+	Owner    eos.AccountName `json:"owner"`
+	Amount   int64           `json:"amount"`
+	LockType int16           `json:"locktype"`
+}
+
+// NewAddLocked builds a privileged addlocked action, which locks amount of owner's tokens using one of the genesis
+// grant types (LockedFounder, LockedMember, LockedPresale, or LockedGiveaway). The actor must be eosio.
+func NewAddLocked(owner eos.AccountName, amount uint64, grantType uint32, actor eos.AccountName) (*Action, error) {
+	switch true {
+	case eos.CheckUnderOver(amount) != nil:
+		return nil, eos.CheckUnderOver(amount)
+	case amount == 0:
+		return nil, errors.New("must lock a positive amount")
+	case grantType < LockedFounder || grantType > LockedGiveaway:
+		return nil, errors.New("invalid grant type, must be 1-4")
+	}
+	return NewAction("eosio", "addlocked", actor, AddLocked{
+		Owner:    owner,
+		Amount:   int64(amount),
+		LockType: int16(grantType),
+	}), nil
+}
+
+// AddGenLocked creates a general (FIP-6 style) lock for an account using arbitrary periods. This is a privileged
+// action requiring the eosio or fio.token account's authority, and is only useful on development and test networks.
+type AddGenLocked struct {
+	Owner   eos.AccountName `json:"owner"`
+	Periods []LockPeriods   `json:"periods"`
+	CanVote bool            `json:"canvote"`
+	Amount  int64           `json:"amount"`
+}
+
+// NewAddGenLocked builds a privileged addgenlocked action. Periods must have increasing, non-zero durations and their
+// percentages must total 100%.
+func NewAddGenLocked(owner eos.AccountName, periods []LockPeriods, canVote bool, amount uint64, actor eos.AccountName) (*Action, error) {
+	switch true {
+	case eos.CheckUnderOver(amount) != nil:
+		return nil, eos.CheckUnderOver(amount)
+	case amount == 0:
+		return nil, errors.New("must lock a positive amount")
+	}
+	if err := validLockPeriods(periods); err != nil {
+		return nil, err
+	}
+	return NewAction("eosio", "addgenlocked", actor, AddGenLocked{
+		Owner:   owner,
+		Periods: periods,
+		CanVote: canVote,
+		Amount:  int64(amount),
+	}), nil
+}
+
+func validLockPeriods(periods []LockPeriods) error {
+	if len(periods) == 0 {
+		return errors.New("no periods provided")
+	}
 	var pct float64
-	for i := range tlt.Periods {
-		pct += tlt.Periods[i].Percent
+	var last uint64
+	for i := range periods {
+		if periods[i].Duration <= last {
+			return errors.New("period durations must be greater than zero and increasing")
+		}
+		if periods[i].Percent <= 0 {
+			return errors.New("period percentage must be positive")
+		}
+		last = periods[i].Duration
+		pct += periods[i].Percent
 	}
-	if pct != 100 {
+	if math.Abs(pct-100) > 0.000001 {
 		return errors.New("percentage must equal 100%")
 	}
-	resp, _ := api.GetFioAccount(string(act))
-	if resp != nil {
-		return errors.New("cannot transfer to an existing account")
-	}
 	return nil
 }
 
@@ -366,6 +444,64 @@ func (api *API) GetTotalLockTokens() (uint64, error) {
 	return total, nil
 }
 
+// LocksPeriod is a single unlock period returned by get_locks. Older nodes report a percentage, newer nodes report
+// the amount unlocked.
+type LocksPeriod struct {
+	Duration uint64  `json:"duration"`
+	Percent  float64 `json:"percent,omitempty"`
+	Amount   uint64  `json:"amount,omitempty"`
+}
+
+// LocksResp is the lock schedule (FIP-6 grants and unstaking locks) for a public key
+type LocksResp struct {
+	LockAmount          uint64        `json:"lock_amount"`
+	RemainingLockAmount uint64        `json:"remaining_lock_amount"`
+	TimeStamp           int64         `json:"time_stamp"`
+	PayoutsPerformed    uint32        `json:"payouts_performed"`
+	CanVote             int32         `json:"can_vote"`
+	UnlockPeriods       []LocksPeriod `json:"unlock_periods"`
+}
+
+// LockUnlock is when, and how many tokens, will be unlocked for a period
+type LockUnlock struct {
+	Time   time.Time
+	Amount uint64
+}
+
+// Schedule converts the unlock periods into absolute times and amounts, periods that have already been paid out
+// are not included.
+func (l *LocksResp) Schedule() []LockUnlock {
+	sched := make([]LockUnlock, 0)
+	for i, p := range l.UnlockPeriods {
+		if i < int(l.PayoutsPerformed) {
+			continue
+		}
+		amount := p.Amount
+		if amount == 0 {
+			amount = uint64(math.Round(p.Percent * float64(l.LockAmount) / 100))
+		}
+		sched = append(sched, LockUnlock{
+			Time:   time.Unix(l.TimeStamp+int64(p.Duration), 0).UTC(),
+			Amount: amount,
+		})
+	}
+	return sched
+}
+
+type getLocksReq struct {
+	FioPublicKey string `json:"fio_public_key"`
+}
+
+// GetLocks gets the lock schedule for a public key. An account without locks returns a 404 APIError.
+func (api *API) GetLocks(pubkey string) (*LocksResp, error) {
+	locks := &LocksResp{}
+	err := api.call("chain", "get_locks", &getLocksReq{FioPublicKey: pubkey}, locks)
+	if err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
 /*
    Circulating Supply
 */
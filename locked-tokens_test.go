@@ -1,6 +1,8 @@
 package fio
 
 import (
+	"encoding/json"
+	"net/http"
 	"testing"
 	"time"
 )
@@ -89,4 +91,111 @@ func TestAPI_GetCirculatingSupply(t *testing.T) {
 	pp := message.NewPrinter(language.AmericanEnglish)
 	pp.Printf("circulating %d, minted %d, locked %d\n", circ/b, minted/b, locked/b)
 }
-*/
\ No newline at end of file
+*/
+
+func TestNewAddLocked(t *testing.T) {
+	if _, err := NewAddLocked("htjonrkf1lgs", Tokens(100), LockedPresale, "eosio"); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewAddLocked("htjonrkf1lgs", 0, LockedPresale, "eosio"); err == nil {
+		t.Error("allowed zero amount")
+	}
+	if _, err := NewAddLocked("htjonrkf1lgs", Tokens(100), 5, "eosio"); err == nil {
+		t.Error("allowed invalid grant type")
+	}
+
+	act, err := NewAddGenLocked("htjonrkf1lgs", []LockPeriods{{Duration: 86400, Percent: 40}, {Duration: 172800, Percent: 60}}, true, Tokens(100), "eosio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Name != "addgenlocked" || act.Data.(AddGenLocked).Amount != int64(Tokens(100)) {
+		t.Error("action was not built correctly")
+	}
+	if _, err = NewAddGenLocked("htjonrkf1lgs", []LockPeriods{{Duration: 86400, Percent: 50}}, true, Tokens(100), "eosio"); err == nil {
+		t.Error("allowed allocation < 100%")
+	}
+	if _, err = NewAddGenLocked("htjonrkf1lgs", []LockPeriods{{Duration: 172800, Percent: 50}, {Duration: 86400, Percent: 50}}, true, Tokens(100), "eosio"); err == nil {
+		t.Error("allowed decreasing durations")
+	}
+	if _, err = NewAddGenLocked("htjonrkf1lgs", nil, true, Tokens(100), "eosio"); err == nil {
+		t.Error("allowed empty periods")
+	}
+}
+
+func TestAPI_GetLocks(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_locks" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"lock_amount":4000,"remaining_lock_amount":3000,"time_stamp":1600000000,"payouts_performed":1,` +
+			`"can_vote":1,"unlock_periods":[{"duration":86400,"percent":25.0},{"duration":172800,"amount":1000},` +
+			`{"duration":259200,"percent":50.0}]}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	locks, err := api.GetLocks("FIO5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locks.RemainingLockAmount != 3000 || len(locks.UnlockPeriods) != 3 {
+		t.Fatalf("unexpected response: %+v", locks)
+	}
+	sched := locks.Schedule()
+	if len(sched) != 2 {
+		t.Fatalf("paid out periods should be skipped, got %d", len(sched))
+	}
+	if sched[0].Amount != 1000 || !sched[0].Time.Equal(time.Unix(1600172800, 0)) {
+		t.Errorf("unexpected first unlock: %+v", sched[0])
+	}
+	if sched[1].Amount != 2000 || !sched[1].Time.Equal(time.Unix(1600259200, 0)) {
+		t.Errorf("percent should be converted to an amount: %+v", sched[1])
+	}
+}
+
+func TestAPI_NewValidTransferLockedTokens(t *testing.T) {
+	const existing = "FIO5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82"
+	existingActor, _ := ActorFromPub(existing)
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chain/get_currency_balance":
+			_, _ = w.Write([]byte(`[]`))
+		case "/v1/chain/get_account":
+			req := make(map[string]string)
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["account_name"] == string(existingActor) {
+				_, _ = w.Write([]byte(`{"account_name":"` + req["account_name"] + `"}`))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	random, _ := NewRandomAccount()
+	thirds := []LockPeriods{{Duration: 86400, Percent: 33.3}, {Duration: 172800, Percent: 33.3}, {Duration: 259200, Percent: 33.4}}
+	act, err := api.NewValidTransferLockedTokens("htjonrkf1lgs", random.PubKey, true, thirds, Tokens(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Name != "trnsloctoks" || act.Data.(TransferLockedTokens).CanVote != CanVoteAll {
+		t.Errorf("unexpected action: %s %+v", act.Name, act.Data)
+	}
+	if _, err = api.NewValidTransferLockedTokens("htjonrkf1lgs", existing, true, thirds, Tokens(10)); err == nil {
+		t.Error("allowed transfer to an existing account")
+	}
+	if _, err = api.NewValidTransferLockedTokens("htjonrkf1lgs", random.PubKey, true, nil, Tokens(10)); err == nil {
+		t.Error("allowed empty periods")
+	}
+	if _, err = api.NewValidTransferLockedTokens("htjonrkf1lgs", random.PubKey, true, thirds[:2], Tokens(10)); err == nil {
+		t.Error("allowed allocation < 100%")
+	}
+}
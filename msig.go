@@ -1,6 +1,7 @@
 package fio
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -253,7 +254,11 @@ func (api *API) NewSignedMsigPropose(proposalName Name, approvers []string, acti
 			return nil, errors.New("invalid approver in list, account name should be < 12 chars")
 		}
 	}
-	propTx := NewTransaction(actions, txOpt)
+	fee, err := LookupMaxFee(FeeMsigPropose)
+	if err != nil {
+		return nil, err
+	}
+	propTx := NewTransaction(api.applyTpid(actions), txOpt)
 	propTx.Expiration = eos.JSONTime{Time: time.Now().UTC().Add(expires)}
 	propTxSigned, propTxPacked, err := api.SignTransaction(propTx, txOpt.ChainID, CompressionNone)
 	if err != nil {
@@ -266,7 +271,7 @@ func (api *API) NewSignedMsigPropose(proposalName Name, approvers []string, acti
 			Proposer:     signer.Actor,
 			ProposalName: proposalName.ToEos(),
 			Requested:    NewPermissionLevelSlice(approvers),
-			MaxFee:       Tokens(GetMaxFee(FeeMsigPropose)) * feeBytes,
+			MaxFee:       Tokens(fee) * feeBytes,
 			Trx:          propTxSigned,
 		},
 	)}, txOpt)
@@ -330,6 +335,121 @@ func NewUpdateAuthSimple(account eos.AccountName, actors []string, threshold uin
 	})
 }
 
+// NewUpdateAuth creates or changes a permission on an account. The authority is checked for consistency (a non-zero
+// threshold that the weights can reach, no zero weights or duplicates) and its keys, accounts, and waits are sorted
+// into the order the chain requires.
+func NewUpdateAuth(actor eos.AccountName, permission string, parent string, auth Authority) (*Action, error) {
+	if permission == "" {
+		return nil, errors.New("permission name is required")
+	}
+	if permission != "owner" && parent == "" {
+		return nil, errors.New("parent permission is required")
+	}
+	sorted, err := auth.validated()
+	if err != nil {
+		return nil, err
+	}
+	fee, err := LookupMaxFee(FeeAuthUpdate)
+	if err != nil {
+		return nil, err
+	}
+	return NewAction("eosio", "updateauth", actor, UpdateAuth{
+		Account:    actor,
+		Permission: eos.Name(permission),
+		Parent:     eos.Name(parent),
+		Auth:       sorted,
+		MaxFee:     Tokens(fee),
+	}), nil
+}
+
+// validated returns a sorted copy of the authority, or an error if the threshold can't be met
+func (auth Authority) validated() (Authority, error) {
+	if auth.Threshold == 0 {
+		return Authority{}, errors.New("threshold must be greater than zero")
+	}
+	out := Authority{
+		Threshold: auth.Threshold,
+		Keys:      append(make([]KeyWeight, 0, len(auth.Keys)), auth.Keys...),
+		Accounts:  append(make([]eos.PermissionLevelWeight, 0, len(auth.Accounts)), auth.Accounts...),
+		Waits:     append(make([]eos.WaitWeight, 0, len(auth.Waits)), auth.Waits...),
+	}
+	var total uint64
+	seen := make(map[string]bool)
+	for _, k := range out.Keys {
+		if k.Weight == 0 {
+			return Authority{}, fmt.Errorf("key %s has a weight of zero", k.PublicKey.String())
+		}
+		if seen[k.PublicKey.String()] {
+			return Authority{}, fmt.Errorf("key %s is listed more than once", k.PublicKey.String())
+		}
+		seen[k.PublicKey.String()] = true
+		total += uint64(k.Weight)
+	}
+	for _, a := range out.Accounts {
+		if a.Weight == 0 {
+			return Authority{}, fmt.Errorf("account %s@%s has a weight of zero", a.Permission.Actor, a.Permission.Permission)
+		}
+		level := string(a.Permission.Actor) + "@" + string(a.Permission.Permission)
+		if seen[level] {
+			return Authority{}, fmt.Errorf("account %s is listed more than once", level)
+		}
+		seen[level] = true
+		total += uint64(a.Weight)
+	}
+	for _, w := range out.Waits {
+		if w.Weight == 0 {
+			return Authority{}, fmt.Errorf("wait of %d seconds has a weight of zero", w.WaitSec)
+		}
+		total += uint64(w.Weight)
+	}
+	if total < uint64(out.Threshold) {
+		return Authority{}, fmt.Errorf("threshold %d is greater than the total weight %d", out.Threshold, total)
+	}
+
+	sort.Slice(out.Keys, func(i, j int) bool {
+		a, b := out.Keys[i].PublicKey, out.Keys[j].PublicKey
+		if a.Curve != b.Curve {
+			return a.Curve < b.Curve
+		}
+		return bytes.Compare(a.Content, b.Content) < 0
+	})
+	nameVal := func(n string) uint64 {
+		v, _ := eos.StringToName(n)
+		return v
+	}
+	sort.Slice(out.Accounts, func(i, j int) bool {
+		a, b := out.Accounts[i].Permission, out.Accounts[j].Permission
+		if a.Actor != b.Actor {
+			return nameVal(string(a.Actor)) < nameVal(string(b.Actor))
+		}
+		return nameVal(string(a.Permission)) < nameVal(string(b.Permission))
+	})
+	sort.Slice(out.Waits, func(i, j int) bool {
+		return out.Waits[i].WaitSec < out.Waits[j].WaitSec
+	})
+	return out, nil
+}
+
+// LinkAuth assigns the permission required to call a contract action
+type LinkAuth struct {
+	Account     eos.AccountName    `json:"account"`
+	Code        eos.AccountName    `json:"code"`
+	Type        eos.ActionName     `json:"type"`
+	Requirement eos.PermissionName `json:"requirement"`
+	MaxFee      uint64             `json:"max_fee"`
+}
+
+// NewLinkAuth allows the requirement permission, rather than active, to sign for the code::type action
+func NewLinkAuth(actor eos.AccountName, code string, actionType string, requirement string) *Action {
+	return NewAction("eosio", "linkauth", actor, LinkAuth{
+		Account:     actor,
+		Code:        eos.AccountName(code),
+		Type:        eos.ActionName(actionType),
+		Requirement: eos.PermissionName(requirement),
+		MaxFee:      Tokens(GetMaxFee(FeeAuthLink)),
+	})
+}
+
 type msigProposalRow struct {
 	ProposalName      eos.Name `json:"proposal_name"`
 	PackedTransaction string    `json:"packed_transaction"`
@@ -0,0 +1,172 @@
+package fio
+
+import (
+	"github.com/fioprotocol/fio-go/eos"
+	"github.com/fioprotocol/fio-go/eos/ecc"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewUpdateAuth(t *testing.T) {
+	keys := make([]KeyWeight, 3)
+	for i := range keys {
+		acc, err := NewRandomAccount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := ecc.NewPublicKey(acc.PubKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = KeyWeight{PublicKey: pub, Weight: 1}
+	}
+
+	// 2-of-3 active permission
+	act, err := NewUpdateAuth("htjonrkf1lgs", "active", "owner", Authority{Threshold: 2, Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Account != "eosio" || act.Name != "updateauth" || act.Authorization[0].Actor != "htjonrkf1lgs" {
+		t.Errorf("unexpected action: %s::%s", act.Account, act.Name)
+	}
+	update := act.Data.(UpdateAuth)
+	if update.Permission != "active" || update.Parent != "owner" || update.Auth.Threshold != 2 || len(update.Auth.Keys) != 3 {
+		t.Errorf("unexpected data: %+v", update)
+	}
+	if update.MaxFee != Tokens(GetMaxFee(FeeAuthUpdate)) {
+		t.Error("max fee was not populated")
+	}
+	for i := 1; i < len(update.Auth.Keys); i++ {
+		if string(update.Auth.Keys[i-1].PublicKey.Content) >= string(update.Auth.Keys[i].PublicKey.Content) {
+			t.Error("keys were not sorted")
+		}
+	}
+	if _, err = eos.MarshalBinary(update); err != nil {
+		t.Error(err)
+	}
+
+	accounts := Authority{Threshold: 1, Accounts: []eos.PermissionLevelWeight{
+		{Permission: eos.PermissionLevel{Actor: "zzzzzzzzzzzz", Permission: "active"}, Weight: 1},
+		{Permission: eos.PermissionLevel{Actor: "aaaaaaaaaaaa", Permission: "active"}, Weight: 1},
+	}}
+	act, err = NewUpdateAuth("htjonrkf1lgs", "payout", "active", accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Data.(UpdateAuth).Auth.Accounts[0].Permission.Actor != "aaaaaaaaaaaa" {
+		t.Error("accounts were not sorted")
+	}
+	if accounts.Accounts[0].Permission.Actor != "zzzzzzzzzzzz" {
+		t.Error("the caller's authority was modified")
+	}
+
+	invalid := map[string]Authority{
+		"zero threshold":     {Threshold: 0, Keys: keys},
+		"unreachable":        {Threshold: 4, Keys: keys},
+		"zero weight":        {Threshold: 1, Keys: []KeyWeight{{PublicKey: keys[0].PublicKey, Weight: 0}}},
+		"duplicate key":      {Threshold: 2, Keys: []KeyWeight{keys[0], keys[0]}},
+		"duplicate account":  {Threshold: 1, Accounts: append(accounts.Accounts, accounts.Accounts[0])},
+		"zero weighted wait": {Threshold: 1, Keys: keys, Waits: []eos.WaitWeight{{WaitSec: 10}}},
+	}
+	for name, auth := range invalid {
+		if _, err = NewUpdateAuth("htjonrkf1lgs", "active", "owner", auth); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err = NewUpdateAuth("htjonrkf1lgs", "payout", "", accounts); err == nil {
+		t.Error("expected an error without a parent")
+	}
+}
+
+func TestNewLinkAuth(t *testing.T) {
+	act := NewLinkAuth("htjonrkf1lgs", "fio.token", "trnsfiopubky", "payout")
+	if act.Account != "eosio" || act.Name != "linkauth" {
+		t.Errorf("unexpected action: %s::%s", act.Account, act.Name)
+	}
+	link := act.Data.(LinkAuth)
+	if link.Account != "htjonrkf1lgs" || link.Code != "fio.token" || link.Type != "trnsfiopubky" || link.Requirement != "payout" {
+		t.Errorf("unexpected data: %+v", link)
+	}
+	if link.MaxFee != Tokens(GetMaxFee(FeeAuthLink)) {
+		t.Error("max fee was not populated")
+	}
+}
+
+func TestAPI_NewSignedMsigPropose(t *testing.T) {
+	acc, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	txOpts := &TxOptions{}
+	if err = txOpts.FillFromChain(api.API); err != nil {
+		t.Fatal(err)
+	}
+
+	// eosio.null::nonce does nothing, making it a safe proposal
+	noop := NewAction("eosio.null", "nonce", acc.Actor, struct {
+		Value string `json:"value"`
+	}{"no-op"})
+	approvers := []string{"bp1bp1bp1bp1", "bp2bp2bp2bp2", "bp3bp3bp3bp3"}
+	if _, err = api.NewSignedMsigPropose(Name("noop"), approvers, nil, time.Hour, acc, txOpts); err == nil {
+		t.Error("expected an error without actions")
+	}
+	packed, err := api.NewSignedMsigPropose(Name("noop"), approvers, []*Action{noop}, time.Hour, acc, txOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := packed.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signed.Actions) != 1 || signed.Actions[0].Account != "eosio.msig" || signed.Actions[0].Name != "propose" {
+		t.Fatal("expected a single eosio.msig::propose action")
+	}
+	if len(packed.Signatures) != 1 {
+		t.Error("proposal was not signed")
+	}
+	propose := MsigPropose{}
+	if err = eos.UnmarshalBinary(signed.Actions[0].HexData, &propose); err != nil {
+		t.Fatal(err)
+	}
+	if propose.Proposer != acc.Actor || propose.ProposalName != "noop" || len(propose.Requested) != 3 {
+		t.Errorf("unexpected proposal: %+v", propose)
+	}
+	if propose.MaxFee != Tokens(GetMaxFee(FeeMsigPropose)) {
+		t.Errorf("a small proposal should pay the base fee, got %d", propose.MaxFee)
+	}
+	if len(propose.Trx.Actions) != 1 || propose.Trx.Actions[0].Account != "eosio.null" {
+		t.Error("proposed transaction does not contain the no-op")
+	}
+}
+
+func TestNewMsigProposeApproveExec(t *testing.T) {
+	noop := NewAction("eosio.null", "nonce", "htjonrkf1lgs", struct {
+		Value string `json:"value"`
+	}{"no-op"})
+	tx := NewTransaction([]*Action{noop}, nil)
+	signers := NewPermissionLevelSlice([]string{"bp1bp1bp1bp1", "bp2bp2bp2bp2"})
+	propose := NewMsigPropose("htjonrkf1lgs", "noop", signers, eos.NewSignedTransaction(tx))
+	if propose.Account != "eosio.msig" || propose.Name != "propose" {
+		t.Errorf("unexpected action: %s::%s", propose.Account, propose.Name)
+	}
+	data := propose.Data.(MsigPropose)
+	if len(data.Requested) != 2 || data.Requested[0].Permission != "active" || data.MaxFee != Tokens(GetMaxFee(FeeMsigPropose)) {
+		t.Errorf("unexpected proposal: %+v", data)
+	}
+
+	approve := NewMsigApprove("htjonrkf1lgs", "noop", "bp1bp1bp1bp1", nil)
+	approveData := approve.Data.(*MsigApprove)
+	if approve.Authorization[0].Actor != "bp1bp1bp1bp1" || approveData.Level.Actor != "bp1bp1bp1bp1" || approveData.Proposer != "htjonrkf1lgs" {
+		t.Errorf("unexpected approval: %+v", approveData)
+	}
+
+	exec := NewMsigExec("htjonrkf1lgs", "noop", Tokens(GetMaxFee(FeeMsigExec)), "bp2bp2bp2bp2")
+	execData := exec.Data.(*MsigExec)
+	if exec.Name != "exec" || execData.Executer != "bp2bp2bp2bp2" || execData.ProposalName != "noop" {
+		t.Errorf("unexpected exec: %+v", execData)
+	}
+}
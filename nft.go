@@ -1,10 +1,13 @@
 package fio
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
 	"regexp"
+	"strings"
 )
 
 // BurnNfts is intended to be called by block producers to remove expired NFT mappings from RAM
@@ -35,23 +38,38 @@ type NftToAdd struct {
 	Metadata        interface{} `json:"metadata"` // because this may change, it is an interface
 }
 
-// encodeMeta converts the Metadata field to an escaped json string
-func (nft *NftToAdd) encodeMeta() nftEncoded {
+// encodeMeta converts the Metadata field to an escaped json string. A string (or json.RawMessage) must be empty
+// or valid JSON and is used as-is, anything else is marshalled, maps are encoded with sorted keys so the result is
+// deterministic.
+func (nft *NftToAdd) encodeMeta() (nftEncoded, error) {
 	var md string
-	if nft.Metadata != nil {
-		j, e := json.Marshal(nft.Metadata)
-		if e == nil && string(j) != `""` {
-			md = fmt.Sprintf("%s", string(j))
+	switch m := nft.Metadata.(type) {
+	case nil:
+	case string:
+		if m != "" && !json.Valid([]byte(m)) {
+			return nftEncoded{}, errors.New("metadata is not valid JSON")
 		}
+		md = m
+	case json.RawMessage:
+		if len(m) > 0 && !json.Valid(m) {
+			return nftEncoded{}, errors.New("metadata is not valid JSON")
+		}
+		md = string(m)
+	default:
+		j, e := json.Marshal(m)
+		if e != nil {
+			return nftEncoded{}, fmt.Errorf("metadata could not be encoded: %s", e)
+		}
+		md = string(j)
 	}
 	return nftEncoded{
-		ChainCode:       nft.ChainCode,
+		ChainCode:       ChainCode(nft.ChainCode).Normalize().String(),
 		ContractAddress: nft.ContractAddress,
 		TokenId:         nft.TokenId,
 		Url:             nft.Url,
 		Hash:            nft.Hash,
 		Metadata:        md,
-	}
+	}, nil
 }
 
 // nftEncoded is what is serialized for the packed transaction, using an interface for NftToAdd.Metadata allows some flexibility
@@ -100,14 +118,20 @@ type addNft struct {
 
 // NewAddNft creates an AddNft fio.Action
 func NewAddNft(fioAddress string, nfts []NftToAdd, actor eos.AccountName) (*Action, error) {
+	fee, err := LookupMaxFee(FeeAddNft)
+	if err != nil {
+		return nil, err
+	}
 	n := make([]nftEncoded, len(nfts))
 	for i := range nfts {
-		n[i] = nfts[i].encodeMeta()
+		if n[i], err = nfts[i].encodeMeta(); err != nil {
+			return nil, fmt.Errorf("nft %d: %s", i, err)
+		}
 	}
 	add := &addNft{
 		FioAddress: fioAddress,
 		Nfts:       n,
-		MaxFee:     Tokens(GetMaxFee(FeeAddNft)),
+		MaxFee:     Tokens(fee),
 		Tpid:       CurrentTpid(),
 		Actor:      actor,
 	}
@@ -117,6 +141,61 @@ func NewAddNft(fioAddress string, nfts []NftToAdd, actor eos.AccountName) (*Acti
 	return NewAction("fio.address", "addnft", actor, add), nil
 }
 
+// RemNftByHash looks up the NFT mapped to addr with the given hash and builds the remnft action for it. An error
+// is returned if the hash does not match exactly one NFT on the address.
+func (api *API) RemNftByHash(fioAddress string, hash string, actor eos.AccountName) (*Action, error) {
+	nfts, err := api.GetNftsHash(hash, 0, 100)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]NftToDelete, 0)
+	for _, n := range nfts.Nfts {
+		if n.FioAddress != "" && n.FioAddress != fioAddress {
+			continue
+		}
+		matches = append(matches, NftToDelete{
+			ChainCode:       n.ChainCode,
+			ContractAddress: n.ContractAddress,
+			TokenId:         n.TokenId,
+		})
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: hash %s is not mapped to %s", ErrNftNotFound, hash, fioAddress)
+	case 1:
+		return NewRemNft(fioAddress, matches, actor)
+	}
+	return nil, fmt.Errorf("hash %s matches %d nfts on %s, use NewRemNft to select which to remove", hash, len(matches), fioAddress)
+}
+
+// MaxNftsPerTx is the most NFTs the contract accepts in a single addnft action
+const MaxNftsPerTx = 3
+
+// NewAddNftBatched splits nfts into multiple addnft actions of at most perTx entries each, if perTx is less than 1
+// or greater than MaxNftsPerTx, MaxNftsPerTx is used. Each action should be pushed in its own transaction, since
+// every action is charged a fee and bundling them would exceed transaction limits.
+func NewAddNftBatched(fioAddress string, nfts []NftToAdd, actor eos.AccountName, perTx int) ([]*Action, error) {
+	if len(nfts) == 0 {
+		return nil, fmt.Errorf("min 1 nft is required")
+	}
+	if perTx < 1 || perTx > MaxNftsPerTx {
+		perTx = MaxNftsPerTx
+	}
+	actions := make([]*Action, 0, (len(nfts)+perTx-1)/perTx)
+	for i := 0; i < len(nfts); i += perTx {
+		end := i + perTx
+		if end > len(nfts) {
+			end = len(nfts)
+		}
+		action, err := NewAddNft(fioAddress, nfts[i:end], actor)
+		if err != nil {
+			return nil, fmt.Errorf("nfts %d-%d: %s", i, end-1, err)
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
 // MustNewAddNft panics on error
 func MustNewAddNft(fioAddress string, nfts []NftToAdd, actor eos.AccountName) *Action {
 	a, e := NewAddNft(fioAddress, nfts, actor)
@@ -179,10 +258,14 @@ func NewRemNft(fioAddress string, nfts []NftToDelete, actor eos.AccountName) (*A
 			return nil, fmt.Errorf("token code must be (%q) < 64 characters", nfts[i].TokenId)
 		}
 	}
+	fee, err := LookupMaxFee(FeeRemoveNft)
+	if err != nil {
+		return nil, err
+	}
 	return NewAction("fio.address", "remnft", actor, &RemNft{
 		FioAddress: fioAddress,
 		Nfts:       nfts,
-		MaxFee:     Tokens(GetMaxFee(FeeRemoveNft)),
+		MaxFee:     Tokens(fee),
 		Actor:      actor,
 		Tpid:       CurrentTpid(),
 	}), nil
@@ -216,12 +299,50 @@ func NewRemAllNft(fioAddress string, actor eos.AccountName) *Action {
 }
 
 type Nft struct {
+	FioAddress      string `json:"fio_address,omitempty"` // only included in get_nfts_hash and get_nfts_contract responses
 	ChainCode       string `json:"chain_code,omitempty"`
 	ContractAddress string `json:"contract_address,omitempty"`
 	TokenId         string `json:"token_id,omitempty"`
 	Url             string `json:"url,omitempty"`
 	Hash            string `json:"hash,omitempty"`
 	Metadata        string `json:"metadata,omitempty"`
+
+	// MetadataJson holds the parsed Metadata if it is a JSON object, otherwise it is nil.
+	MetadataJson map[string]interface{} `json:"-"`
+}
+
+// Key identifies an NFT by chain code, contract address, and token id. The chain code is normalized, but the contract
+// address is not because some chains have case-sensitive addresses.
+func (nft Nft) Key() string {
+	return ChainCode(nft.ChainCode).Normalize().String() + ":" + nft.ContractAddress + ":" + nft.TokenId
+}
+
+// DedupNfts merges NFTs from several queries, removing those with the same Key. The first occurrence is kept and
+// the original order is preserved.
+func DedupNfts(nfts []Nft) []Nft {
+	seen := make(map[string]bool, len(nfts))
+	out := make([]Nft, 0, len(nfts))
+	for _, nft := range nfts {
+		if seen[nft.Key()] {
+			continue
+		}
+		seen[nft.Key()] = true
+		out = append(out, nft)
+	}
+	return out
+}
+
+// parseMetadata populates MetadataJson if the metadata is a valid JSON object
+func (nft *Nft) parseMetadata() {
+	nft.MetadataJson = nil
+	if nft.Metadata == "" {
+		return
+	}
+	md := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(nft.Metadata), &md); err != nil {
+		return
+	}
+	nft.MetadataJson = md
 }
 
 type NftResponse struct {
@@ -229,6 +350,73 @@ type NftResponse struct {
 	More uint32 `json:"more"`
 }
 
+// parseMetadata populates MetadataJson on each NFT in the response
+func (nr *NftResponse) parseMetadata() {
+	if nr == nil {
+		return
+	}
+	for i := range nr.Nfts {
+		nr.Nfts[i].parseMetadata()
+	}
+}
+
+// AddNftAndVerify adds NFTs to a FIO address, waits for the transaction to become irreversible, and then confirms
+// each NFT is present. NFTs are matched using their hash, or if not provided, the chain code, contract, and token id.
+// An error listing any that could not be found is returned. All requests, including the push, are bound to ctx.
+func (api *API) AddNftAndVerify(ctx context.Context, account *Account, addr string, nfts []NftToAdd) error {
+	act, err := NewAddNft(addr, nfts, account.Actor)
+	if err != nil {
+		return err
+	}
+	resp, err := api.signPushActionsCtx(ctx, act)
+	if err != nil {
+		return err
+	}
+	if err = api.waitForIrreversible(ctx, resp.Processed.BlockNum); err != nil {
+		return err
+	}
+
+	nftKey := func(hash, chainCode, contract, tokenId string) string {
+		if hash != "" {
+			return strings.ToLower(hash)
+		}
+		return strings.ToLower(chainCode) + ":" + contract + ":" + tokenId
+	}
+	found := make(map[string]bool)
+	var offset uint32
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		page, err := api.GetNftsFioAddressCtx(ctx, addr, offset, 100)
+		if errors.Is(err, ErrNftNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for _, n := range page.Nfts {
+			found[nftKey(n.Hash, n.ChainCode, n.ContractAddress, n.TokenId)] = true
+		}
+		if page.More == 0 || len(page.Nfts) == 0 {
+			break
+		}
+		offset += uint32(len(page.Nfts))
+	}
+
+	missing := make([]string, 0)
+	for _, n := range nfts {
+		k := nftKey(n.Hash, n.ChainCode, n.ContractAddress, n.TokenId)
+		if !found[k] {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("nfts were not found on %s after adding: %s", addr, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 type getNftsReq struct {
 	FioAddress      string `json:"fio_address,omitempty"`
 	ChainCode       string `json:"chain_code,omitempty"`
@@ -239,35 +427,112 @@ type getNftsReq struct {
 	Offset          uint32 `json:"offset,omitempty"`
 }
 
+// ErrNftNotFound is returned by the NFT getters when the node has no matching NFTs, allowing an empty result to be
+// distinguished from a transport or node error.
+var ErrNftNotFound = errors.New("no matching nfts found")
+
+// nftResult maps the node's not-found response, or an empty result, to ErrNftNotFound
+func (nr *NftResponse) nftResult(err error) error {
+	if err != nil {
+		if IsNotFound(err) {
+			return ErrNftNotFound
+		}
+		return err
+	}
+	if len(nr.Nfts) == 0 {
+		return ErrNftNotFound
+	}
+	nr.parseMetadata()
+	return nil
+}
+
 // GetNftsFioAddress fetches the list of NFTs for a FIO address
 func (api *API) GetNftsFioAddress(fioAddress string, offset uint32, limit uint32) (nfts *NftResponse, err error) {
+	return api.GetNftsFioAddressCtx(context.Background(), fioAddress, offset, limit)
+}
+
+// GetNftsFioAddressCtx is the same as GetNftsFioAddress, but the request is cancelled when ctx is done
+func (api *API) GetNftsFioAddressCtx(ctx context.Context, fioAddress string, offset uint32, limit uint32) (nfts *NftResponse, err error) {
 	nfts = &NftResponse{
 		Nfts: make([]Nft, 0),
 	}
-	err = api.call("chain", "get_nfts_fio_address", getNftsReq{FioAddress: fioAddress, Limit: limit, Offset: offset}, nfts)
+	err = api.callCtx(ctx, "chain", "get_nfts_fio_address", getNftsReq{FioAddress: fioAddress, Limit: limit, Offset: offset}, nfts)
+	err = nfts.nftResult(err)
 	return
 }
 
-// GetNftsContract fetches the list of NFTs for a contract address
+// nftsBatch is the page size used by AllNftsForAddress
+const nftsBatch = 100
+
+// AllNftsForAddress pages through GetNftsFioAddress until every NFT for the address is retrieved. An empty slice
+// and nil error are returned if there are none. If a page fails, the NFTs already retrieved are returned with the error.
+func (api *API) AllNftsForAddress(fioAddress string) ([]Nft, error) {
+	return api.AllNftsForAddressCtx(context.Background(), fioAddress)
+}
+
+// AllNftsForAddressCtx is the same as AllNftsForAddress, but the requests are cancelled when ctx is done
+func (api *API) AllNftsForAddressCtx(ctx context.Context, fioAddress string) ([]Nft, error) {
+	all := make([]Nft, 0)
+	for offset := uint32(0); ; offset += nftsBatch {
+		page, err := api.GetNftsFioAddressCtx(ctx, fioAddress, offset, nftsBatch)
+		if errors.Is(err, ErrNftNotFound) {
+			return all, nil
+		}
+		if err != nil {
+			return all, err
+		}
+		all = append(all, page.Nfts...)
+		if page.More == 0 || len(page.Nfts) < nftsBatch {
+			return all, nil
+		}
+	}
+}
+
+// GetNftsContract fetches the list of NFTs for a contract address. The node's lookup is case-sensitive and the chain
+// code is sent as given, so records added before chain codes were normalized can still be found. NFTs added with
+// NewAddNft use an upper-case chain code, see ChainCode.Normalize.
 func (api *API) GetNftsContract(chaincode, contractAddress, tokenid string, offset uint32, limit uint32) (nfts *NftResponse, err error) {
+	return api.GetNftsContractCtx(context.Background(), chaincode, contractAddress, tokenid, offset, limit)
+}
+
+// GetNftsContractCtx is the same as GetNftsContract, but the request is cancelled when ctx is done
+func (api *API) GetNftsContractCtx(ctx context.Context, chaincode, contractAddress, tokenid string, offset uint32, limit uint32) (nfts *NftResponse, err error) {
 	nfts = &NftResponse{
 		Nfts: make([]Nft, 0),
 	}
-	err = api.call("chain", "get_nfts_contract", getNftsReq{
+	err = api.callCtx(ctx, "chain", "get_nfts_contract", getNftsReq{
 		ChainCode:       chaincode,
 		ContractAddress: contractAddress,
 		TokenId:         tokenid,
 		Limit:           limit,
 		Offset:          offset,
 	}, nfts)
+	err = nfts.nftResult(err)
 	return
 }
 
+// GetAllNftsForContract fetches every NFT for a contract address, it is the same as calling GetNftsContract with an
+// empty token id, which is left out of the request.
+func (api *API) GetAllNftsForContract(chaincode, contractAddress string, offset uint32, limit uint32) (nfts *NftResponse, err error) {
+	return api.GetNftsContract(chaincode, contractAddress, "", offset, limit)
+}
+
+// GetAllNftsForContractCtx is the same as GetAllNftsForContract, but the request is cancelled when ctx is done
+func (api *API) GetAllNftsForContractCtx(ctx context.Context, chaincode, contractAddress string, offset uint32, limit uint32) (nfts *NftResponse, err error) {
+	return api.GetNftsContractCtx(ctx, chaincode, contractAddress, "", offset, limit)
+}
+
 // GetNftsHash fetches the list of NFTs for a specific NFT Hash
 func (api *API) GetNftsHash(hash string, offset uint32, limit uint32) (nfts *NftResponse, err error) {
+	return api.GetNftsHashCtx(context.Background(), hash, offset, limit)
+}
+
+// GetNftsHashCtx is the same as GetNftsHash, but the request is cancelled when ctx is done
+func (api *API) GetNftsHashCtx(ctx context.Context, hash string, offset uint32, limit uint32) (nfts *NftResponse, err error) {
 	nfts = &NftResponse{
 		Nfts: make([]Nft, 0),
 	}
-	err = api.call("chain", "get_nfts_hash", getNftsReq{Hash: hash, Limit: limit, Offset: offset}, nfts)
+	err = api.callCtx(ctx, "chain", "get_nfts_hash", getNftsReq{Hash: hash, Limit: limit, Offset: offset}, nfts)
+	err = nfts.nftResult(err)
 	return
 }
@@ -1,10 +1,13 @@
 package fio
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
@@ -126,8 +129,8 @@ func TestNft(t *testing.T) {
 	}
 
 	nfts, err = api.GetNftsHash(h1, 0, 100)
-	if err == nil {
-		t.Error("NFT was not deleted")
+	if !errors.Is(err, ErrNftNotFound) {
+		t.Error("NFT was not deleted", err)
 		return
 	}
 	nfts, err = api.GetNftsFioAddress(addr, 0, 100)
@@ -180,3 +183,369 @@ func TestNft(t *testing.T) {
 	}
 
 }
+
+func TestAPI_AddNftAndVerify(t *testing.T) {
+	onChain := make([]Nft, 0)
+	acc, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chain/push_transaction":
+			_, _ = w.Write([]byte(`{"transaction_id":"00","processed":{"block_num":3}}`))
+		case "/v1/chain/get_nfts_fio_address":
+			_ = json.NewEncoder(w).Encode(NftResponse{Nfts: onChain})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	nfts := []NftToAdd{
+		{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "1", Hash: "AAAA"},
+		{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "2"},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	onChain = append(onChain, Nft{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "1", Hash: "aaaa"})
+	err = api.AddNftAndVerify(ctx, acc, "test@fiotestnet", nfts)
+	if err == nil || !strings.Contains(err.Error(), "eth:0x123:2") {
+		t.Error("expected an error listing the missing nft, got:", err)
+	}
+
+	onChain = append(onChain, Nft{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "2"})
+	if err = api.AddNftAndVerify(ctx, acc, "test@fiotestnet", nfts); err != nil {
+		t.Error(err)
+	}
+
+	// a node that never answers should not outlive the context
+	release := make(chan struct{})
+	_, hung, hungSrv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/push_transaction" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		<-release
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hungSrv.Close()
+	defer close(release)
+	short, cancelShort := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelShort()
+	start := time.Now()
+	if err = hung.AddNftAndVerify(short, acc, "test@fiotestnet", nfts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("push did not honor the context")
+	}
+}
+
+func TestNftResponse_parseMetadata(t *testing.T) {
+	resp := &NftResponse{}
+	err := json.Unmarshal([]byte(`{"nfts":[
+		{"chain_code":"ETH","contract_address":"0x123","token_id":"1","metadata":"{\"creator_url\":\"https://fioprotocol.io\"}"},
+		{"chain_code":"ETH","contract_address":"0x123","token_id":"2","metadata":"just a string"},
+		{"chain_code":"ETH","contract_address":"0x123","token_id":"3"}
+	],"more":0}`), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.parseMetadata()
+	if resp.Nfts[0].MetadataJson == nil || resp.Nfts[0].MetadataJson["creator_url"] != "https://fioprotocol.io" {
+		t.Error("json metadata was not parsed")
+	}
+	if resp.Nfts[0].Metadata != `{"creator_url":"https://fioprotocol.io"}` {
+		t.Error("raw metadata was not preserved")
+	}
+	if resp.Nfts[1].MetadataJson != nil || resp.Nfts[1].Metadata != "just a string" {
+		t.Error("plain string metadata should not be parsed")
+	}
+	if resp.Nfts[2].MetadataJson != nil {
+		t.Error("empty metadata should not be parsed")
+	}
+}
+
+func TestNewAddNftBatched(t *testing.T) {
+	nfts := make([]NftToAdd, 8)
+	for i := range nfts {
+		nfts[i] = NftToAdd{ChainCode: "ETH", ContractAddress: "0x123", TokenId: fmt.Sprint(i)}
+	}
+	for _, tc := range []struct {
+		perTx int
+		sizes []int
+	}{
+		{0, []int{3, 3, 2}},
+		{2, []int{2, 2, 2, 2}},
+		{1, []int{1, 1, 1, 1, 1, 1, 1, 1}},
+		{10, []int{3, 3, 2}},
+	} {
+		actions, err := NewAddNftBatched("alice@fiotestnet", nfts, "htjonrkf1lgs", tc.perTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actions) != len(tc.sizes) {
+			t.Errorf("perTx %d: expected %d actions, got %d", tc.perTx, len(tc.sizes), len(actions))
+			continue
+		}
+		next := 0
+		for i, a := range actions {
+			batch := a.Data.(*addNft).Nfts
+			if len(batch) != tc.sizes[i] {
+				t.Errorf("perTx %d: action %d has %d nfts, expected %d", tc.perTx, i, len(batch), tc.sizes[i])
+			}
+			for _, n := range batch {
+				if n.TokenId != fmt.Sprint(next) {
+					t.Errorf("perTx %d: nft %s out of order, expected %d", tc.perTx, n.TokenId, next)
+				}
+				next++
+			}
+		}
+	}
+	if _, err := NewAddNftBatched("alice@fiotestnet", nil, "htjonrkf1lgs", 3); err == nil {
+		t.Error("expected error for empty nfts")
+	}
+	nfts[4].ChainCode = "bad code"
+	if _, err := NewAddNftBatched("alice@fiotestnet", nfts, "htjonrkf1lgs", 3); err == nil {
+		t.Error("expected error for invalid nft")
+	}
+}
+
+func TestNewAddNft_metadata(t *testing.T) {
+	nft := func(md interface{}) NftToAdd {
+		return NftToAdd{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "1", Metadata: md}
+	}
+	meta := func(a *Action) string {
+		return a.Data.(*addNft).Nfts[0].Metadata
+	}
+
+	a, err := NewAddNft("alice@fiotestnet", []NftToAdd{nft(map[string]string{"b": "2", "a": "1"})}, "htjonrkf1lgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta(a) != `{"a":"1","b":"2"}` {
+		t.Errorf("map was not encoded deterministically: %s", meta(a))
+	}
+	for _, md := range []interface{}{nil, "", `{"creator":"alice"}`, json.RawMessage(`[1,2]`)} {
+		if _, err = NewAddNft("alice@fiotestnet", []NftToAdd{nft(md)}, "htjonrkf1lgs"); err != nil {
+			t.Errorf("%v: %v", md, err)
+		}
+	}
+	a, _ = NewAddNft("alice@fiotestnet", []NftToAdd{nft(`{"creator":"alice"}`)}, "htjonrkf1lgs")
+	if meta(a) != `{"creator":"alice"}` {
+		t.Errorf("json string should be used as-is, got %s", meta(a))
+	}
+
+	_, err = NewAddNft("alice@fiotestnet", []NftToAdd{nft(""), nft(`{"unterminated`)}, "htjonrkf1lgs")
+	if err == nil || !strings.Contains(err.Error(), "nft 1") {
+		t.Errorf("expected error naming nft 1, got %v", err)
+	}
+	if _, err = NewAddNft("alice@fiotestnet", []NftToAdd{nft(make(chan int))}, "htjonrkf1lgs"); err == nil {
+		t.Error("expected error for metadata that cannot be marshalled")
+	}
+}
+
+func TestAPI_GetAllNftsForContract(t *testing.T) {
+	var sentTokenId []bool
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_nfts_contract" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		raw := make(map[string]interface{})
+		_ = json.NewDecoder(r.Body).Decode(&raw)
+		tokenId, hasTokenId := raw["token_id"]
+		sentTokenId = append(sentTokenId, hasTokenId)
+		resp := NftResponse{Nfts: make([]Nft, 0)}
+		for i := 0; i < 5; i++ {
+			id := fmt.Sprint(i)
+			if !hasTokenId || tokenId == id {
+				resp.Nfts = append(resp.Nfts, Nft{ChainCode: "ETH", ContractAddress: "0x123", TokenId: id})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	single, err := api.GetNftsContract("ETH", "0x123", "3", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single.Nfts) != 1 || single.Nfts[0].TokenId != "3" {
+		t.Errorf("expected a single token, got %d", len(single.Nfts))
+	}
+	all, err := api.GetAllNftsForContract("ETH", "0x123", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Nfts) != 5 {
+		t.Errorf("expected 5 tokens, got %d", len(all.Nfts))
+	}
+	if len(sentTokenId) != 2 || !sentTokenId[0] || sentTokenId[1] {
+		t.Errorf("token id should only be sent for the single token query: %v", sentTokenId)
+	}
+}
+
+func TestNftResponse_nftResult(t *testing.T) {
+	status, body := http.StatusNotFound, ""
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	status, body = http.StatusNotFound, `{"type":"invalid_input","message":"No NFTS are mapped"}`
+	if _, err = api.GetNftsHash("abc", 0, 10); !errors.Is(err, ErrNftNotFound) {
+		t.Errorf("expected ErrNftNotFound for 404, got %v", err)
+	}
+	status, body = http.StatusOK, `{"nfts":[],"more":0}`
+	if _, err = api.GetNftsFioAddress("alice@fiotestnet", 0, 10); !errors.Is(err, ErrNftNotFound) {
+		t.Errorf("expected ErrNftNotFound for empty result, got %v", err)
+	}
+	status, body = http.StatusInternalServerError, `{"code":500,"message":"Internal Service Error"}`
+	if _, err = api.GetNftsHash("abc", 0, 10); err == nil || errors.Is(err, ErrNftNotFound) {
+		t.Errorf("a node error should not be reported as not found, got %v", err)
+	}
+	status, body = http.StatusOK, `{"nfts":[{"chain_code":"ETH","contract_address":"0x123","token_id":"1"}],"more":0}`
+	if nfts, err := api.GetNftsHash("abc", 0, 10); err != nil || len(nfts.Nfts) != 1 {
+		t.Errorf("expected a result, got %v", err)
+	}
+}
+
+func TestAPI_RemNftByHash(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		req := getNftsReq{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		resp := NftResponse{Nfts: make([]Nft, 0)}
+		switch req.Hash {
+		case "single":
+			resp.Nfts = append(resp.Nfts,
+				Nft{FioAddress: "alice@fiotestnet", ChainCode: "ETH", ContractAddress: "0x123", TokenId: "7", Hash: "single"},
+				Nft{FioAddress: "bob@fiotestnet", ChainCode: "ETH", ContractAddress: "0x456", TokenId: "8", Hash: "single"},
+			)
+		case "multiple":
+			resp.Nfts = append(resp.Nfts,
+				Nft{FioAddress: "alice@fiotestnet", ChainCode: "ETH", ContractAddress: "0x123", TokenId: "1", Hash: "multiple"},
+				Nft{FioAddress: "alice@fiotestnet", ChainCode: "ETH", ContractAddress: "0x123", TokenId: "2", Hash: "multiple"},
+			)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	act, err := api.RemNftByHash("alice@fiotestnet", "single", "htjonrkf1lgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rem := act.Data.(*RemNft)
+	if act.Name != "remnft" || len(rem.Nfts) != 1 || rem.Nfts[0] != (NftToDelete{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "7"}) {
+		t.Errorf("unexpected remnft action: %+v", rem)
+	}
+	if _, err = api.RemNftByHash("alice@fiotestnet", "multiple", "htjonrkf1lgs"); err == nil {
+		t.Error("expected error when hash matches multiple nfts")
+	}
+	if _, err = api.RemNftByHash("alice@fiotestnet", "missing", "htjonrkf1lgs"); !errors.Is(err, ErrNftNotFound) {
+		t.Errorf("expected ErrNftNotFound, got %v", err)
+	}
+	if _, err = api.RemNftByHash("carol@fiotestnet", "single", "htjonrkf1lgs"); !errors.Is(err, ErrNftNotFound) {
+		t.Errorf("expected ErrNftNotFound for nft on another address, got %v", err)
+	}
+}
+
+func TestAPI_AllNftsForAddress(t *testing.T) {
+	const total = 250
+	var failAt uint32
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_nfts_fio_address" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := getNftsReq{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if failAt != 0 && req.Offset >= failAt {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"code":500,"message":"Internal Service Error","error":{"code":0,"name":"timeout","what":"deadline exceeded","details":[]}}`))
+			return
+		}
+		resp := NftResponse{Nfts: make([]Nft, 0)}
+		for i := req.Offset; i < req.Offset+req.Limit && i < total; i++ {
+			resp.Nfts = append(resp.Nfts, Nft{ChainCode: "ETH", ContractAddress: "0x123", TokenId: fmt.Sprint(i)})
+		}
+		if remaining := int(total) - int(req.Offset) - len(resp.Nfts); remaining > 0 {
+			resp.More = uint32(remaining)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	nfts, err := api.AllNftsForAddress("collector@fiotestnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nfts) != total || nfts[total-1].TokenId != fmt.Sprint(total-1) {
+		t.Errorf("expected %d nfts in order, got %d", total, len(nfts))
+	}
+
+	failAt = 200
+	nfts, err = api.AllNftsForAddress("collector@fiotestnet")
+	if err == nil {
+		t.Error("expected an error from the failed page")
+	}
+	if len(nfts) != 200 {
+		t.Errorf("expected the 200 nfts retrieved before the failure, got %d", len(nfts))
+	}
+}
+
+func TestDedupNfts(t *testing.T) {
+	byAddress := []Nft{
+		{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "1"},
+		{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "2"},
+	}
+	byContract := []Nft{
+		{FioAddress: "collector@fiotestnet", ChainCode: "eth", ContractAddress: "0x123", TokenId: "2"},
+		{FioAddress: "collector@fiotestnet", ChainCode: "ETH", ContractAddress: "0x123", TokenId: "3"},
+	}
+	byHash := []Nft{
+		{ChainCode: "ETH", ContractAddress: "0x123", TokenId: "1", Hash: "aaaa"},
+		{ChainCode: "SOL", ContractAddress: "AbC", TokenId: "1"},
+		{ChainCode: "SOL", ContractAddress: "abc", TokenId: "1"},
+	}
+	if byAddress[1].Key() != byContract[0].Key() {
+		t.Error("chain code case should not change the key")
+	}
+	if byHash[1].Key() == byHash[2].Key() {
+		t.Error("contract address case should change the key")
+	}
+
+	merged := DedupNfts(append(append(append([]Nft{}, byAddress...), byContract...), byHash...))
+	want := []string{"ETH:0x123:1", "ETH:0x123:2", "ETH:0x123:3", "SOL:AbC:1", "SOL:abc:1"}
+	if len(merged) != len(want) {
+		t.Fatalf("expected %d nfts, got %d", len(want), len(merged))
+	}
+	for i := range want {
+		if merged[i].Key() != want[i] {
+			t.Errorf("position %d: expected %s, got %s", i, want[i], merged[i].Key())
+		}
+	}
+	if merged[1].FioAddress != "" {
+		t.Error("the first occurrence should be kept")
+	}
+	if len(DedupNfts(nil)) != 0 {
+		t.Error("expected an empty result")
+	}
+}
@@ -14,14 +14,15 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // VoteProducer votes for a producer
 type VoteProducer struct {
-	Producers  []string `json:"producers"`
-	FioAddress string   `json:"fio_address,omitempty"`
-	Actor      eos.AccountName
-	MaxFee     uint64 `json:"max_fee"`
+	Producers  []string        `json:"producers"`
+	FioAddress string          `json:"fio_address,omitempty"`
+	Actor      eos.AccountName `json:"actor"`
+	MaxFee     uint64          `json:"max_fee"`
 }
 
 // NewVoteProducer creates a VoteProducer action: note - fioAddress is optional as of FIP-009
@@ -38,6 +39,36 @@ func NewVoteProducer(producers []string, actor eos.AccountName, fioAddress strin
 	)
 }
 
+// MaxVoteProducers is the most producers that can be voted for in a single voteproducer action
+const MaxVoteProducers = 30
+
+// NewValidVoteProducer is the same as NewVoteProducer, but checks that the producer list is not empty, not too long,
+// and only holds unique, valid FIO addresses. The supplied slice is not modified.
+func NewValidVoteProducer(producers []string, actor eos.AccountName, fioAddress string) (*Action, error) {
+	if len(producers) == 0 {
+		return nil, errors.New("producer list is empty")
+	}
+	if len(producers) > MaxVoteProducers {
+		return nil, fmt.Errorf("cannot vote for more than %d producers", MaxVoteProducers)
+	}
+	seen := make(map[string]bool)
+	for _, p := range producers {
+		if err := ValidateFioAddress(Address(p)); err != nil {
+			return nil, fmt.Errorf("producer %q: %v", p, err)
+		}
+		if seen[p] {
+			return nil, fmt.Errorf("producer %q is listed more than once", p)
+		}
+		seen[p] = true
+	}
+	if fioAddress != "" && !Address(fioAddress).Valid() {
+		return nil, errors.New("invalid fio address")
+	}
+	sorted := make([]string, len(producers))
+	copy(sorted, producers)
+	return NewVoteProducer(sorted, actor, fioAddress), nil
+}
+
 // BpClaim requests payout for a block producer
 type BpClaim struct {
 	FioAddress string          `json:"fio_address"`
@@ -84,6 +115,10 @@ func NewRegProducer(fioAddress string, fioPubKey string, url string, location Pr
 	if !strings.Contains("10 20 30 40 50 60 70 80", strconv.Itoa(int(location))) {
 		return nil, errors.New("location must be one of: 10 20 30 40 50 60 70 80")
 	}
+	fee, err := LookupMaxFee(FeeRegisterProducer)
+	if err != nil {
+		return nil, err
+	}
 	return NewAction("eosio", "regproducer", actor,
 		RegProducer{
 			FioAddress: fioAddress,
@@ -91,7 +126,7 @@ func NewRegProducer(fioAddress string, fioPubKey string, url string, location Pr
 			Url:        url,
 			Location:   uint16(location),
 			Actor:      actor,
-			MaxFee:     Tokens(GetMaxFee(FeeRegisterProducer)),
+			MaxFee:     Tokens(fee),
 		}), nil
 }
 
@@ -137,6 +172,17 @@ func NewVoteProxy(proxy string, fioAddress string, actor eos.AccountName) *Actio
 	)
 }
 
+// NewValidVoteProxy is the same as NewVoteProxy, but checks the proxy and optional fioAddress are valid
+func NewValidVoteProxy(proxy string, fioAddress string, actor eos.AccountName) (*Action, error) {
+	if err := ValidateFioAddress(Address(proxy)); err != nil {
+		return nil, fmt.Errorf("proxy %q: %v", proxy, err)
+	}
+	if fioAddress != "" && !Address(fioAddress).Valid() {
+		return nil, errors.New("invalid fio address")
+	}
+	return NewVoteProxy(proxy, fioAddress, actor), nil
+}
+
 type RegProxy struct {
 	FioAddress string          `json:"fio_address"`
 	Actor      eos.AccountName `json:"actor"`
@@ -232,6 +278,42 @@ func (api *API) GetFioProducers() (fioProducers *Producers, err error) {
 	return
 }
 
+// GetProducers gets a page of the producer table, ranked by total votes (highest first), which is the order used for
+// the producer schedule. Unlike the eos-go call it replaces, it understands FIO's response. When there are more
+// producers after this page, More holds the offset to request next.
+func (api *API) GetProducers(limit, offset int) (*Producers, error) {
+	if limit < 1 || offset < 0 {
+		return nil, errors.New("limit must be positive and offset cannot be negative")
+	}
+	all := &Producers{}
+	err := api.call("chain", "get_producers", map[string]interface{}{"limit": 1000, "json": true}, all)
+	if err != nil {
+		return nil, err
+	}
+	votes := func(i int) float64 {
+		f, _ := strconv.ParseFloat(all.Producers[i].TotalVotes, 64)
+		return f
+	}
+	sort.SliceStable(all.Producers, func(i, j int) bool {
+		return votes(i) > votes(j)
+	})
+	page := &Producers{
+		Producers:               make([]Producer, 0),
+		TotalProducerVoteWeight: all.TotalProducerVoteWeight,
+	}
+	if offset >= len(all.Producers) {
+		return page, nil
+	}
+	end := offset + limit
+	if end < len(all.Producers) {
+		page.More = strconv.Itoa(end)
+	} else {
+		end = len(all.Producers)
+	}
+	page.Producers = append(page.Producers, all.Producers[offset:end]...)
+	return page, nil
+}
+
 type BpJsonOrg struct {
 	CandidateName       string `json:"candidate_name"`
 	Website             string `json:"website"`
@@ -513,3 +595,82 @@ func (api *API) GetVotes(account string) (votedFor []string, err error) {
 	}
 	return
 }
+
+// VoterInfo is a row from the eosio voters table
+type VoterInfo struct {
+	Owner          eos.AccountName `json:"owner"`
+	Proxy          eos.AccountName `json:"proxy"`
+	Producers      []string        `json:"producers"`
+	LastVoteWeight string          `json:"last_vote_weight"`
+	IsProxy        uint8           `json:"is_proxy"`
+}
+
+// Voted returns true if the voter has an active vote, either for producers or via a proxy
+func (v VoterInfo) Voted() bool {
+	if v.Proxy != "" {
+		return true
+	}
+	for _, p := range v.Producers {
+		if p != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVoterRow decodes the rows returned from the voters table, returning nil if none were found
+func parseVoterRow(rows json.RawMessage) (*VoterInfo, error) {
+	v := make([]*VoterInfo, 0)
+	if err := json.Unmarshal(rows, &v); err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return v[0], nil
+}
+
+// HasVoted reports whether an account has an active producer (or proxy) vote. Because the voters table does not
+// record when the vote was cast, the last vote time is found by searching the account's recent actions, and will
+// be a zero value if the vote is older than the last 100 actions or the server does not provide the history API.
+func (api *API) HasVoted(account eos.AccountName) (voted bool, lastVote time.Time, err error) {
+	getVote, err := api.GetTableRows(eos.GetTableRowsRequest{
+		Code:       "eosio",
+		Scope:      "eosio",
+		Table:      "voters",
+		Index:      "3",
+		LowerBound: string(account),
+		UpperBound: string(account),
+		Limit:      1,
+		KeyType:    "name",
+		JSON:       true,
+	})
+	if err != nil {
+		return
+	}
+	v, err := parseVoterRow(getVote.Rows)
+	if err != nil || v == nil || !v.Voted() {
+		return
+	}
+	voted = true
+	if !api.HasHistory() {
+		return
+	}
+	acts, err := api.GetActions(account, -1, -100)
+	if err != nil {
+		// the vote is known to exist, so a failure to find the time should not be fatal
+		return voted, lastVote, nil
+	}
+	for _, a := range acts.Actions {
+		if a.Trace.Action == nil || a.Trace.Action.Account != "eosio" {
+			continue
+		}
+		if a.Trace.Action.Name != "voteproducer" && a.Trace.Action.Name != "voteproxy" {
+			continue
+		}
+		if a.BlockTime.Time.After(lastVote) {
+			lastVote = a.BlockTime.Time
+		}
+	}
+	return
+}
@@ -1,7 +1,9 @@
 package fio
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/fioprotocol/fio-go/eos"
 	"math/rand"
 	"net"
 	"net/http"
@@ -326,3 +328,107 @@ func TestIsPrivate(t *testing.T) {
 		}
 	}
 }
+
+func TestParseVoterRow(t *testing.T) {
+	const rows = `[{"id":12,"fioaddress":"","addresshash":"0x00000000000000000000000000000000","owner":"htjonrkf1lgs","proxy":"","producers":["qbxn5zhw2ypw","hfdg2qumuvlc"],"last_vote_weight":"10000000000000.00000000000000000","proxied_vote_weight":"0.00000000000000000","is_proxy":0,"is_auto_proxy":0,"reserved2":0,"reserved3":"0.0000 FIO"}]`
+	v, err := parseVoterRow([]byte(rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v == nil || v.Owner != "htjonrkf1lgs" || len(v.Producers) != 2 || !v.Voted() {
+		t.Errorf("voter row did not decode as expected: %+v", v)
+	}
+
+	v, err = parseVoterRow([]byte(`[{"owner":"htjonrkf1lgs","proxy":"","producers":[]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Voted() {
+		t.Error("voter with no producers or proxy should not have voted")
+	}
+
+	v, err = parseVoterRow([]byte(`[]`))
+	if err != nil || v != nil {
+		t.Error("empty result should return nil row")
+	}
+}
+
+func TestNewValidVoteProducer(t *testing.T) {
+	prods := []string{"bp2@dapixdev", "bp1@dapixdev"}
+	act, err := NewValidVoteProducer(prods, "htjonrkf1lgs", "ada@dapixdev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prods[0] != "bp2@dapixdev" {
+		t.Error("caller's slice should not be sorted in place")
+	}
+	bin, err := eos.MarshalBinary(act.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{2, 12}, []byte("bp1@dapixdev")...)
+	want = append(want, 12)
+	want = append(want, []byte("bp2@dapixdev")...)
+	if !bytes.HasPrefix(bin, want) {
+		t.Errorf("producer array was not serialized sorted: %x", bin)
+	}
+	if act.Data.(VoteProducer).MaxFee != Tokens(GetMaxFee(FeeVoteProducer)) {
+		t.Error("max fee was not populated")
+	}
+
+	for _, bad := range [][]string{nil, {"bp1@dapixdev", "bp1@dapixdev"}, {"not valid"}, make([]string, MaxVoteProducers+1)} {
+		if _, err = NewValidVoteProducer(bad, "htjonrkf1lgs", ""); err == nil {
+			t.Errorf("%v should be rejected", bad)
+		}
+	}
+
+	proxy, err := NewValidVoteProxy("proxy@dapixdev", "", "htjonrkf1lgs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy.Name != "voteproxy" || proxy.Data.(VoteProxy).Proxy != "proxy@dapixdev" {
+		t.Errorf("unexpected action: %s %+v", proxy.Name, proxy.Data)
+	}
+	if _, err = NewValidVoteProxy("", "", "htjonrkf1lgs"); err == nil {
+		t.Error("empty proxy should be rejected")
+	}
+}
+
+func TestAPI_GetProducers(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_producers" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"producers":[` +
+			`{"owner":"bpc","fio_address":"c@dapixdev","total_votes":"10.00000000000000000","is_active":1},` +
+			`{"owner":"bpa","fio_address":"a@dapixdev","total_votes":"30.00000000000000000","is_active":1},` +
+			`{"owner":"bpb","fio_address":"b@dapixdev","total_votes":"20.00000000000000000","is_active":0}` +
+			`],"total_producer_vote_weight":"60.00000000000000000","more":""}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	page, err := api.GetProducers(2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Producers) != 2 || page.Producers[0].FioAddress != "a@dapixdev" || page.Producers[1].IsActive != 0 || page.More != "2" {
+		t.Errorf("unexpected first page: %+v", page)
+	}
+	page, err = api.GetProducers(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Producers) != 1 || page.Producers[0].Owner != "bpc" || page.More != "" {
+		t.Errorf("unexpected last page: %+v", page)
+	}
+	if page, _ = api.GetProducers(2, 5); len(page.Producers) != 0 {
+		t.Error("offset past the end should be empty")
+	}
+	if _, err = api.GetProducers(0, 0); err == nil {
+		t.Error("expected an error for a zero limit")
+	}
+}
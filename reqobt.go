@@ -17,9 +17,15 @@ import (
 	"github.com/fioprotocol/fio-go/eos"
 	"github.com/fioprotocol/fio-go/eos/btcsuite/btcutil"
 	"github.com/fioprotocol/fio-go/eos/ecc"
+	"github.com/shopspring/decimal"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -30,6 +36,19 @@ const (
 
 type ObtType uint8
 
+// ObtTypeFromAction gives the type of content created by a fio.reqobt action, useful when decrypting content
+// found in a transaction.
+func ObtTypeFromAction(name eos.ActionName) ObtType {
+	switch name {
+	case "newfundsreq":
+		return ObtRequestType
+	case "recordobt":
+		return ObtResponseType
+	default:
+		return ObtInvalidType
+	}
+}
+
 func (o ObtType) String() string {
 	switch o {
 	case ObtRequestType:
@@ -41,6 +60,14 @@ func (o ObtType) String() string {
 	}
 }
 
+// maxContentLen is the largest encrypted content the contract accepts for the type
+func (o ObtType) maxContentLen() int {
+	if o == ObtRequestType {
+		return ObtRequestContentMaxLen
+	}
+	return ObtRecordContentMaxLen
+}
+
 // ObtRequestContent holds details for requesting funds
 type ObtRequestContent struct {
 	PayeePublicAddress string `json:"payee_public_address"`
@@ -63,8 +90,50 @@ type obtRequestContentOmit struct {
 	OfflineUrl         string `json:"offline_url,omitempty"`
 }
 
+// Maximum length of the base64 encoded content field accepted by the fio.reqobt contract.
+const (
+	ObtRequestContentMaxLen = 296
+	ObtRecordContentMaxLen  = 432
+)
+
+// ErrContentTooLarge is returned when encrypted content would exceed the on-chain size limit.
+var ErrContentTooLarge = errors.New("encrypted content exceeds the maximum size allowed on-chain")
+
+// EciesEncryptedLen returns the length of the base64 string EciesEncrypt produces for a plaintext of the given size.
+func EciesEncryptedLen(plainLen int) int {
+	padded := (plainLen/aes.BlockSize + 1) * aes.BlockSize
+	return base64.StdEncoding.EncodedLen(eciesIvLen + padded + eciesSigLen)
+}
+
+// checkContentLen fails fast, before encryption, if the content would be rejected by the contract.
+func checkContentLen(plainLen int, max int) error {
+	if l := EciesEncryptedLen(plainLen); l > max {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrContentTooLarge, l, max)
+	}
+	return nil
+}
+
 // Encrypt serializes and encrypts the 'content' field for OBT requests
 func (req ObtRequestContent) Encrypt(from *Account, toPubKey string) (content string, err error) {
+	if err = validateObtCodes(req.ChainCode, req.TokenCode); err != nil {
+		return "", err
+	}
+	bin, err := req.EncodeABI()
+	if err != nil {
+		return "", err
+	}
+	if err = checkContentLen(len(bin), ObtRequestContentMaxLen); err != nil {
+		return "", err
+	}
+	encrypted, err := EciesEncrypt(from, toPubKey, bin, nil)
+	if err != nil {
+		return "", err
+	}
+	return encrypted, nil
+}
+
+// EncodeABI serializes the request to the binary form that is encrypted, empty optional fields are omitted.
+func (req ObtRequestContent) EncodeABI() ([]byte, error) {
 	reqOmit := obtRequestContentOmit{
 		PayeePublicAddress: req.PayeePublicAddress,
 		Amount:             req.Amount,
@@ -76,20 +145,11 @@ func (req ObtRequestContent) Encrypt(from *Account, toPubKey string) (content st
 	}
 	j, err := json.Marshal(reqOmit)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	abiReader := bytes.NewReader([]byte(obtAbiJsonOmit))
 	abi, _ := eos.NewABI(abiReader)
-	//bin, err := abi.DecodeTableRowTyped("record_send_content", j)
-	bin, err := abi.EncodeAction("new_funds_content", j)
-	if err != nil {
-		return "", err
-	}
-	encrypted, err := EciesEncrypt(from, toPubKey, bin, nil)
-	if err != nil {
-		return "", err
-	}
-	return encrypted, nil
+	return abi.EncodeAction("new_funds_content", j)
 }
 
 type ObtRecordContent struct {
@@ -118,8 +178,27 @@ type obtRecordContentOmit struct {
 	OfflineUrl         string `json:"offline_url,omitempty"`
 }
 
-// Encrypt serializes and encrypts the 'content' field for OBT requests
+// Encrypt serializes and encrypts the 'content' field for OBT records
 func (rec ObtRecordContent) Encrypt(from *Account, toPubKey string) (content string, err error) {
+	if err = validateObtCodes(rec.ChainCode, rec.TokenCode); err != nil {
+		return "", err
+	}
+	bin, err := rec.EncodeABI()
+	if err != nil {
+		return "", err
+	}
+	if err = checkContentLen(len(bin), ObtRecordContentMaxLen); err != nil {
+		return "", err
+	}
+	encrypted, err := EciesEncrypt(from, toPubKey, bin, nil)
+	if err != nil {
+		return "", err
+	}
+	return encrypted, nil
+}
+
+// EncodeABI serializes the record to the binary form that is encrypted, empty optional fields are omitted.
+func (rec ObtRecordContent) EncodeABI() ([]byte, error) {
 	recOmit := obtRecordContentOmit{
 		rec.PayerPublicAddress,
 		rec.PayeePublicAddress,
@@ -134,20 +213,178 @@ func (rec ObtRecordContent) Encrypt(from *Account, toPubKey string) (content str
 	}
 	j, err := json.Marshal(recOmit)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	abiReader := bytes.NewReader([]byte(obtAbiJsonOmit))
 	abi, _ := eos.NewABI(abiReader)
-	//bin, err := abi.DecodeTableRowTyped("record_send_content", j)
-	bin, err := abi.EncodeAction("record_send_content", j)
+	return abi.EncodeAction("record_send_content", j)
+}
+
+// EncryptABI serializes JSON content (for example from another SDK) using the OBT ABI for the given type and then
+// encrypts it. This is the same encoding used by ObtRequestContent.Encrypt and ObtRecordContent.Encrypt.
+func EncryptABI(from *Account, toPubKey string, obtType ObtType, contentJson []byte) (string, error) {
+	if obtType.String() == "" {
+		return "", errors.New("unknown obtType: expecting fio.ObtResponseType or fio.ObtRequestType")
+	}
+	abi, err := eos.NewABI(bytes.NewReader([]byte(obtAbiJsonOmit)))
 	if err != nil {
 		return "", err
 	}
-	encrypted, err := EciesEncrypt(from, toPubKey, bin, nil)
+	bin, err := abi.EncodeAction(eos.ActionName(obtType.String()), contentJson)
 	if err != nil {
 		return "", err
 	}
-	return encrypted, nil
+	if err = checkContentLen(len(bin), obtType.maxContentLen()); err != nil {
+		return "", err
+	}
+	return EciesEncrypt(from, toPubKey, bin, nil)
+}
+
+// DecryptABI is the inverse of EncryptABI, returning the content as JSON.
+func DecryptABI(to *Account, fromPubKey string, encrypted string, obtType ObtType) (contentJson []byte, err error) {
+	if obtType.String() == "" {
+		return nil, errors.New("unknown obtType: expecting fio.ObtResponseType or fio.ObtRequestType")
+	}
+	bin, err := EciesDecrypt(to, fromPubKey, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	for _, abiJson := range []string{obtAbiJsonOmit, ObtAbiJson} {
+		abi, e := eos.NewABI(bytes.NewReader([]byte(abiJson)))
+		if e != nil {
+			return nil, e
+		}
+		contentJson, err = abi.DecodeTableRowTyped(obtType.String(), bin)
+		if err == nil {
+			return contentJson, nil
+		}
+	}
+	return nil, err
+}
+
+// ObtMemoMaxLen is the longest memo that will be kept inline by SplitMemo. It is a conservative default chosen by this
+// package, not a chain limit: the memo competes for space with the other fields in the encrypted content, which is
+// limited to ObtRequestContentMaxLen or ObtRecordContentMaxLen, and Encrypt returns ErrContentTooLarge if that is
+// exceeded.
+const ObtMemoMaxLen = 64
+
+// MemoUploader stores a full memo somewhere off-chain and returns the URL where it can be retrieved.
+type MemoUploader func(memo []byte) (url string, err error)
+
+// MemoFetcher retrieves a memo previously stored by a MemoUploader.
+type MemoFetcher func(url string) (memo []byte, err error)
+
+// SplitMemo moves an over-long memo off-chain: the full text is passed to upload, OfflineUrl is set to the
+// returned location, Hash is set to the hex sha256 of the full memo, and Memo is truncated to ObtMemoMaxLen.
+// Nothing is changed if the memo already fits.
+func (req *ObtRequestContent) SplitMemo(upload MemoUploader) error {
+	if len(req.Memo) <= ObtMemoMaxLen {
+		return nil
+	}
+	memo, hash, url, err := splitMemo(req.Memo, upload)
+	if err != nil {
+		return err
+	}
+	req.Memo, req.Hash, req.OfflineUrl = memo, hash, url
+	return nil
+}
+
+// SplitMemo moves an over-long memo off-chain, see ObtRequestContent.SplitMemo
+func (rec *ObtRecordContent) SplitMemo(upload MemoUploader) error {
+	if len(rec.Memo) <= ObtMemoMaxLen {
+		return nil
+	}
+	memo, hash, url, err := splitMemo(rec.Memo, upload)
+	if err != nil {
+		return err
+	}
+	rec.Memo, rec.Hash, rec.OfflineUrl = memo, hash, url
+	return nil
+}
+
+// Normalize trims and upper-cases the chain and token codes, Encrypt rejects codes that are not normalized.
+func (req *ObtRequestContent) Normalize() {
+	req.ChainCode = ChainCode(req.ChainCode).Normalize().String()
+	req.TokenCode = TokenCode(req.TokenCode).Normalize().String()
+}
+
+// Normalize trims and upper-cases the chain and token codes, see ObtRequestContent.Normalize
+func (rec *ObtRecordContent) Normalize() {
+	rec.ChainCode = ChainCode(rec.ChainCode).Normalize().String()
+	rec.TokenCode = TokenCode(rec.TokenCode).Normalize().String()
+}
+
+// validateObtCodes ensures mistakes in the codes are caught before they are encrypted and stored on-chain
+func validateObtCodes(chain string, token string) error {
+	if err := ChainCode(chain).Validate(); err != nil {
+		return err
+	}
+	return TokenCode(token).Validate()
+}
+
+// AmountDecimal parses the Amount field, which may carry fractional tokens.
+func (req *ObtRequestContent) AmountDecimal() (decimal.Decimal, error) {
+	return parseObtAmount(req.Amount)
+}
+
+// AmountDecimal parses the Amount field, see ObtRequestContent.AmountDecimal
+func (rec *ObtRecordContent) AmountDecimal() (decimal.Decimal, error) {
+	return parseObtAmount(rec.Amount)
+}
+
+func parseObtAmount(amount string) (decimal.Decimal, error) {
+	trimmed := strings.TrimSpace(amount)
+	if trimmed == "" {
+		return decimal.Zero, errors.New("amount is empty")
+	}
+	d, err := decimal.NewFromString(trimmed)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("amount %q is not a number", amount)
+	}
+	if d.IsNegative() {
+		return decimal.Zero, fmt.Errorf("amount %q is negative", amount)
+	}
+	return d, nil
+}
+
+func splitMemo(memo string, upload MemoUploader) (inline string, hash string, url string, err error) {
+	if len(memo) <= ObtMemoMaxLen {
+		return memo, "", "", nil
+	}
+	if upload == nil {
+		return "", "", "", errors.New("memo is too long and no uploader was provided")
+	}
+	url, err = upload([]byte(memo))
+	if err != nil {
+		return "", "", "", err
+	}
+	sum := sha256.Sum256([]byte(memo))
+	// truncate on a rune boundary so the inline memo stays valid utf-8
+	inline = memo[:ObtMemoMaxLen]
+	for len(inline) > 0 && !utf8.ValidString(inline) {
+		inline = inline[:len(inline)-1]
+	}
+	return inline, hex.EncodeToString(sum[:]), url, nil
+}
+
+// VerifyAndFetchMemo is the inverse of SplitMemo, if offlineUrl is set the full memo is retrieved using fetch
+// and checked against the hash before being returned, otherwise the inline memo is returned as-is.
+func VerifyAndFetchMemo(memo string, hash string, offlineUrl string, fetch MemoFetcher) (string, error) {
+	if offlineUrl == "" {
+		return memo, nil
+	}
+	if fetch == nil {
+		return "", errors.New("memo is stored off-chain and no fetcher was provided")
+	}
+	full, err := fetch(offlineUrl)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(full)
+	if hex.EncodeToString(sum[:]) != strings.ToLower(hash) {
+		return "", fmt.Errorf("memo retrieved from %s does not match hash %s", offlineUrl, hash)
+	}
+	return string(full), nil
 }
 
 type ObtContentResult struct {
@@ -204,6 +441,37 @@ func DecryptContent(to *Account, fromPubKey string, encrypted string, obtType Ob
 	return nil, errors.New("unknown obtType: expecting fio.ObtResponseType or fio.ObtRequestType")
 }
 
+// DecryptContentAuto decrypts content when it isn't known if it is a request or a record, for example when merging sent
+// and received histories. Both shapes are lists of strings, so one can often be decoded as the other: the shape that
+// re-encodes to the same bytes is chosen, otherwise a record is preferred over a request. An error is only returned if
+// neither shape can be decoded.
+func DecryptContentAuto(to *Account, fromPubKey string, encrypted string) (*ObtContentResult, ObtType, error) {
+	bin, err := EciesDecrypt(to, fromPubKey, encrypted)
+	if err != nil {
+		return nil, 0, err
+	}
+	rec, recErr := tryDecryptRecord(bin, ObtResponseType)
+	req, reqErr := tryDecryptRequest(bin, ObtRequestType)
+	recResult := &ObtContentResult{Type: ObtResponseType, Record: rec}
+	reqResult := &ObtContentResult{Type: ObtRequestType, Request: req}
+	switch {
+	case recErr == nil && reEncodes(rec.EncodeABI, bin):
+		return recResult, ObtResponseType, nil
+	case reqErr == nil && reEncodes(req.EncodeABI, bin):
+		return reqResult, ObtRequestType, nil
+	case recErr == nil:
+		return recResult, ObtResponseType, nil
+	case reqErr == nil:
+		return reqResult, ObtRequestType, nil
+	}
+	return nil, 0, fmt.Errorf("content is neither a request (%v) nor a record (%v)", reqErr, recErr)
+}
+
+func reEncodes(encode func() ([]byte, error), bin []byte) bool {
+	b, err := encode()
+	return err == nil && bytes.Equal(b, bin)
+}
+
 type RecordSend struct {
 	FioRequestId    string `json:"fio_request_id"`
 	PayerFioAddress string `json:"payer_fio_address"`
@@ -214,7 +482,34 @@ type RecordSend struct {
 	Tpid            string `json:"tpid"`
 }
 
+// NewRecordSendByID builds the action for providing the result of a off-chain transaction in response to a request
+func NewRecordSendByID(actor eos.AccountName, requestId uint64, payer string, payee string, content string) *Action {
+	return NewRecordSend(actor, strconv.FormatUint(requestId, 10), payer, payee, content)
+}
+
+// NewRecordSendContent normalizes and encrypts the record content for toPub and builds the action responding to a
+// request, NewRecordSendByID can be used with content that is already encrypted.
+func NewRecordSendContent(actor eos.AccountName, requestId uint64, payer string, payee string, content ObtRecordContent, from *Account, toPub string) (*Action, error) {
+	if from == nil {
+		return nil, errors.New("an account is required to encrypt the content")
+	}
+	content.Normalize()
+	encrypted, err := content.Encrypt(from, toPub)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecordSendByID(actor, requestId, payer, payee, encrypted), nil
+}
+
+// NewRecordObt builds the action for recording the result of a off-chain transaction that was not in response
+// to a request.
+func NewRecordObt(actor eos.AccountName, payer string, payee string, content string) *Action {
+	return NewRecordSend(actor, "", payer, payee, content)
+}
+
 // NewRecordSend builds the action for providing the result of a off-chain transaction
+//
+// Deprecated: use NewRecordSendByID, or NewRecordObt if the record is not a response to a request.
 func NewRecordSend(actor eos.AccountName, reqId string, payer string, payee string, content string) *Action {
 	return NewAction(
 		"fio.reqobt", "recordobt", actor,
@@ -267,6 +562,157 @@ func NewFundsReq(actor eos.AccountName, payerFio string, payeeFio string, conten
 	)
 }
 
+// NewFundsReqContent normalizes, validates, and encrypts the request content for toPub and builds the newfundsreq
+// action, NewFundsReq can be used with content that is already encrypted.
+func NewFundsReqContent(actor eos.AccountName, payerFio string, payeeFio string, req ObtRequestContent, from *Account, toPub string) (*Action, error) {
+	if from == nil {
+		return nil, errors.New("an account is required to encrypt the content")
+	}
+	req.Normalize()
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	for _, a := range []string{payerFio, payeeFio} {
+		if err := ValidateFioAddress(Address(a)); err != nil {
+			return nil, fmt.Errorf("invalid fio address %q: %v", a, err)
+		}
+	}
+	encrypted, err := req.Encrypt(from, toPub)
+	if err != nil {
+		return nil, err
+	}
+	return NewFundsReq(actor, payerFio, payeeFio, encrypted), nil
+}
+
+// validate checks the request has a payee address, a positive amount, and valid chain and token codes
+func (req ObtRequestContent) validate() error {
+	if strings.TrimSpace(req.PayeePublicAddress) == "" {
+		return errors.New("payee public address is empty")
+	}
+	amount, err := req.AmountDecimal()
+	if err != nil {
+		return err
+	}
+	if !amount.IsPositive() {
+		return errors.New("amount must be greater than zero")
+	}
+	return validateObtCodes(req.ChainCode, req.TokenCode)
+}
+
+// ObtIdempotency prevents the same funds request from being sent twice, for example when a user double-clicks or
+// a caller retries after a timeout. Callers supply a key that identifies the request, and a second send with the
+// same key inside the window returns the first result instead of pushing another transaction. Keys are held in
+// memory and the number tracked is bounded, the oldest are discarded first.
+type ObtIdempotency struct {
+	mux     sync.Mutex
+	window  time.Duration
+	maxKeys int
+	entries map[string]*idempotentEntry
+}
+
+type idempotentEntry struct {
+	sent time.Time
+	done chan struct{}
+	out  *eos.PushTransactionFullResp
+	err  error
+}
+
+// NewObtIdempotency creates an ObtIdempotency that remembers up to maxKeys keys for the duration of window.
+func NewObtIdempotency(window time.Duration, maxKeys int) *ObtIdempotency {
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	return &ObtIdempotency{
+		window:  window,
+		maxKeys: maxKeys,
+		entries: make(map[string]*idempotentEntry),
+	}
+}
+
+// Do calls push unless the key has already been used within the window, in which case the prior result is
+// returned and duplicate is true. If a push with the same key is still in progress Do waits for it to finish.
+// Failed pushes, including a push that panics, are not remembered so that they may be retried.
+func (o *ObtIdempotency) Do(key string, push func() (*eos.PushTransactionFullResp, error)) (out *eos.PushTransactionFullResp, duplicate bool, err error) {
+	o.mux.Lock()
+	if e := o.entries[key]; e != nil && (e.pending() || time.Since(e.sent) < o.window) {
+		o.mux.Unlock()
+		<-e.done
+		if e.err == nil {
+			return e.out, true, nil
+		}
+		// the prior attempt failed and has been forgotten, try again
+		return o.Do(key, push)
+	}
+	o.evict()
+	e := &idempotentEntry{sent: time.Now(), done: make(chan struct{})}
+	o.entries[key] = e
+	o.mux.Unlock()
+
+	// waiters are released and failures forgotten even if push panics
+	completed := false
+	defer func() {
+		if !completed {
+			e.err = errors.New("push did not complete")
+		}
+		if e.err != nil {
+			o.mux.Lock()
+			if o.entries[key] == e {
+				delete(o.entries, key)
+			}
+			o.mux.Unlock()
+		}
+		close(e.done)
+	}()
+	e.out, e.err = push()
+	completed = true
+	return e.out, false, e.err
+}
+
+// pending is true while the push for the entry is in progress
+func (e *idempotentEntry) pending() bool {
+	select {
+	case <-e.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// evict removes expired keys, and the oldest keys if still at capacity, must be called with the lock held. Keys
+// with a push in progress are never removed, so the map may briefly hold more than maxKeys.
+func (o *ObtIdempotency) evict() {
+	for k, e := range o.entries {
+		if !e.pending() && time.Since(e.sent) >= o.window {
+			delete(o.entries, k)
+		}
+	}
+	for len(o.entries) >= o.maxKeys {
+		var oldest string
+		var oldestTime time.Time
+		for k, e := range o.entries {
+			if !e.pending() && (oldestTime.IsZero() || e.sent.Before(oldestTime)) {
+				oldest, oldestTime = k, e.sent
+			}
+		}
+		if oldestTime.IsZero() {
+			return
+		}
+		delete(o.entries, oldest)
+	}
+}
+
+// SendFundsReq signs and pushes a funds request (see NewFundsReq) using idem to ensure a request with the same
+// key is only sent once. If idem is nil or key is empty the request is sent without any checks.
+func (api *API) SendFundsReq(idem *ObtIdempotency, key string, fundsReq *Action) (out *eos.PushTransactionFullResp, err error) {
+	if idem == nil || key == "" {
+		return api.SignPushActions(fundsReq)
+	}
+	out, _, err = idem.Do(key, func() (*eos.PushTransactionFullResp, error) {
+		return api.SignPushActions(fundsReq)
+	})
+	return
+}
+
 // CancelFndReq allows cancelling a previously sent request
 type CancelFndReq struct {
 	FioRequestId string `json:"fio_request_id"`
@@ -328,7 +774,14 @@ type RejectFndReq struct {
 	Tpid         string `json:"tpid"`
 }
 
+// NewRejectFndReqByID builds the action to reject a request
+func NewRejectFndReqByID(actor eos.AccountName, requestId uint64) *Action {
+	return NewRejectFndReq(actor, strconv.FormatUint(requestId, 10))
+}
+
 // NewRejectFndReq builds the action to reject a request
+//
+// Deprecated: use NewRejectFndReqByID, which takes the uint64 FioRequestId returned by the API.
 func NewRejectFndReq(actor eos.AccountName, requestId string) *Action {
 	return NewAction(
 		"fio.reqobt", "rejectfndreq", actor,
@@ -354,24 +807,11 @@ func NewRejectFndReq(actor eos.AccountName, requestId string) *Action {
 // The 16 byte IV is prepended to the output, resulting in the message format of:
 //  IV + Ciphertext + HMAC
 // See https://github.com/fioprotocol/fiojs/blob/master/docs/message_encryption.md for more information.
+//
+// The chain expects the content field to use standard (padded) base64, which is what is returned here. When sharing
+// content off-chain in a URI or QR code use ContentToURL to get a more compact, URL-safe encoding.
 func EciesEncrypt(sender *Account, recipentPub string, plainText []byte, iv []byte) (content string, err error) {
-
-	// Get the shared-secret
-	_, secretHash, err := EciesSecret(sender, recipentPub)
-	if err != nil {
-		return "", err
-	}
-	hashAgain := sha512.New()
-	_, err = hashAgain.Write(secretHash[:])
-	if err != nil {
-		return "", err
-	}
-	keys := hashAgain.Sum(nil)
-	key := append(keys[:32])    // first half of sha512 hash of secret is used as key
-	macKey := append(keys[32:]) // second half as hmac key
-
 	// Generate IV
-	var contentBuffer bytes.Buffer
 	if len(iv) != 16 || bytes.Equal(iv, make([]byte, 16)) {
 		iv = make([]byte, 16)
 		_, err = rand.Read(iv)
@@ -379,6 +819,27 @@ func EciesEncrypt(sender *Account, recipentPub string, plainText []byte, iv []by
 			return "", err
 		}
 	}
+	return EciesEncryptWithIV(sender, recipentPub, plainText, iv)
+}
+
+// EciesEncryptWithIV is the same as EciesEncrypt, but uses the supplied IV which must be exactly 16 bytes. This gives
+// deterministic output, which is useful for testing against known vectors. The IV should never be re-used when
+// encrypting real content; EciesEncrypt should be preferred.
+func EciesEncryptWithIV(sender *Account, recipientPub string, plainText []byte, iv []byte) (content string, err error) {
+	if len(iv) != 16 {
+		return "", fmt.Errorf("invalid IV length %d, must be 16 bytes", len(iv))
+	}
+
+	// Get the shared-secret, and hash it again for the keys
+	keys, err := eciesKeys(sender, recipientPub)
+	if err != nil {
+		return "", err
+	}
+	defer ZeroSecret(keys)
+	key := keys[:32]    // first half of sha512 hash of secret is used as key
+	macKey := keys[32:] // second half as hmac key
+
+	var contentBuffer bytes.Buffer
 	contentBuffer.Write(iv)
 
 	// AES CBC for encryption,
@@ -388,19 +849,17 @@ func EciesEncrypt(sender *Account, recipentPub string, plainText []byte, iv []by
 	}
 	cbc := cipher.NewCBCEncrypter(block, iv)
 
-	//// create pkcs#7 padding
-	plainText = append(plainText, func() []byte {
-		padLen := block.BlockSize() - (len(plainText) % block.BlockSize())
-		pad := make([]byte, padLen)
-		for i := range pad {
-			pad[i] = uint8(padLen)
-		}
-		return pad
-	}()...)
+	//// create pkcs#7 padding, the plaintext is copied so the caller's slice is not modified
+	padLen := block.BlockSize() - (len(plainText) % block.BlockSize())
+	padded := make([]byte, len(plainText)+padLen)
+	copy(padded, plainText)
+	for i := len(plainText); i < len(padded); i++ {
+		padded[i] = uint8(padLen)
+	}
 
 	// encrypt the plaintext
-	cipherText := make([]byte, len(plainText))
-	cbc.CryptBlocks(cipherText, plainText)
+	cipherText := make([]byte, len(padded))
+	cbc.CryptBlocks(cipherText, padded)
 	contentBuffer.Write(cipherText)
 
 	// Sign the message using sha256 hmac, *second* half of sha512 hash used as key
@@ -420,70 +879,284 @@ func EciesEncrypt(sender *Account, recipentPub string, plainText []byte, iv []by
 	return string(b64Buffer.Bytes()), nil
 }
 
-// EciesDecrypt is the inverse of EciesEncrypt, using the recipient's private key and sender's public instead.
-func EciesDecrypt(recipient *Account, senderPub string, message string) (decrypted []byte, err error) {
-	const (
-		sigLen = 32
-	)
+// ReEncryptContent supports key rotation by decrypting content received by oldRecipient and encrypting it again
+// for newRecipientPub. The ciphertext is the base64 content as stored on-chain, and the result uses the same
+// encoding. Because the content is re-encrypted by oldRecipient, the new key holder must use oldRecipient's public
+// key (not the original sender's) when decrypting.
+func ReEncryptContent(oldRecipient *Account, senderPub string, ciphertext []byte, newRecipientPub string) ([]byte, error) {
+	plainText, err := EciesDecrypt(oldRecipient, senderPub, string(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+	content, err := EciesEncrypt(oldRecipient, newRecipientPub, plainText, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// ContentToURL converts encrypted content from the standard base64 encoding used on-chain to unpadded, URL-safe
+// base64, which is more compact and needs no escaping when used in a URI or QR code.
+func ContentToURL(content string) (string, error) {
+	bin, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bin), nil
+}
+
+// ContentFromURL reverses ContentToURL, returning content in the encoding expected by the chain and DecryptContent.
+func ContentFromURL(urlContent string) (string, error) {
+	bin, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(urlContent, "="))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(bin), nil
+}
+
+// ErrEciesHmac is returned when an ECIES message's HMAC does not match, meaning it was tampered with or
+// the wrong keys were used.
+var ErrEciesHmac = errors.New("hmac signature is invalid")
+
+const (
+	eciesIvLen  = 16
+	eciesSigLen = 32
+)
+
+// VerifyEciesHmac checks only the HMAC of a base64 encoded ECIES message (as found in the content field) without
+// decrypting it. A mismatched HMAC returns false with a nil error, an error indicates the check could not be performed.
+func VerifyEciesHmac(recipient *Account, senderPub string, message []byte) (bool, error) {
+	_, secret, err := eciesVerify(recipient, senderPub, string(message))
+	ZeroSecret(secret)
+	switch err {
+	case nil:
+		return true, nil
+	case ErrEciesHmac:
+		return false, nil
+	}
+	return false, err
+}
 
-	var msg []byte
+// eciesVerify decodes the message and checks the HMAC, returning the raw message and derived key on success.
+func eciesVerify(recipient *Account, senderPub string, message string) (msg []byte, secret []byte, err error) {
 	// convert base64 string to []byte
 	b64Reader := bytes.NewReader([]byte(message))
 	b64Decoder := base64.NewDecoder(base64.StdEncoding, b64Reader)
 	msg, err = ioutil.ReadAll(b64Decoder)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	// Get the shared-secret
-	_, secretHash, err := EciesSecret(recipient, senderPub)
-	if err != nil {
-		return nil, err
+	if len(msg) < eciesIvLen+eciesSigLen {
+		return nil, nil, fmt.Errorf("message is too short (%d bytes), must be at least %d bytes", len(msg), eciesIvLen+eciesSigLen)
 	}
 
-	// Other SDK's hash it TWICE, so we will too ...
-	hashTwice := sha512.New()
-	_, err = hashTwice.Write(secretHash[:])
+	// Get the shared-secret, other SDK's hash it TWICE, so we will too ...
+	secret, err = eciesKeys(recipient, senderPub)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	secret := hashTwice.Sum(nil)
 
 	// check the signature
 	verifier := hmac.New(sha256.New, secret[32:])
-	_, err = verifier.Write(msg[:len(msg)-sigLen])
+	_, err = verifier.Write(msg[:len(msg)-eciesSigLen])
 	if err != nil {
-		return nil, err
+		ZeroSecret(secret)
+		return nil, nil, err
 	}
 	verified := verifier.Sum(nil)
-	if hex.EncodeToString(msg[len(msg)-sigLen:]) != hex.EncodeToString(verified) {
-		return nil,
-			errors.New(
-				fmt.Sprintf("hmac signature %s is invalid, expected %s",
-					hex.EncodeToString(verified),
-					hex.EncodeToString(msg[len(msg)-sigLen:]),
-				),
-			)
+	if !hmac.Equal(verified, msg[len(msg)-eciesSigLen:]) {
+		ZeroSecret(secret)
+		return nil, nil, ErrEciesHmac
+	}
+	return msg, secret, nil
+}
+
+// EciesDecrypt is the inverse of EciesEncrypt, using the recipient's private key and sender's public instead.
+func EciesDecrypt(recipient *Account, senderPub string, message string) (decrypted []byte, err error) {
+	msg, secret, err := eciesVerify(recipient, senderPub, message)
+	if err != nil {
+		return nil, err
 	}
+	defer ZeroSecret(secret)
 
 	// decrypt the message
 	block, err := aes.NewCipher(secret[:32])
 	if err != nil {
 		return nil, err
 	}
+	if (len(msg)-eciesIvLen-eciesSigLen)%block.BlockSize() != 0 {
+		return nil, errors.New("ciphertext is not block-aligned")
+	}
 	cbc := cipher.NewCBCDecrypter(block, msg[:block.BlockSize()])
-	plainText := make([]byte, len(msg[block.BlockSize():len(msg)-sigLen]))
-	cbc.CryptBlocks(plainText, msg[block.BlockSize():len(msg)-sigLen])
+	plainText := make([]byte, len(msg[block.BlockSize():len(msg)-eciesSigLen]))
+	cbc.CryptBlocks(plainText, msg[block.BlockSize():len(msg)-eciesSigLen])
 	if len(plainText) == 0 {
 		return nil, errors.New("could not decrypt message")
 	}
 
-	padLen := int(plainText[len(plainText)-1])
-	if padLen > block.BlockSize() || padLen >= len(plainText) {
-		return nil, errors.New("invalid padding in message")
+	return pkcs7Unpad(plainText, block.BlockSize())
+}
+
+// eciesStreamChunk is how much plaintext or ciphertext is read at a time by the streaming functions
+const eciesStreamChunk = 32 * 1024
+
+// eciesKeys derives the AES key (first 32 bytes) and HMAC key (last 32 bytes) shared by two keys. The shared secret
+// is wiped before returning, the caller is responsible for wiping the keys.
+func eciesKeys(private *Account, public string) ([]byte, error) {
+	return eciesKeysFrom(EciesSecret, private, public)
+}
+
+// eciesKeysFrom is the same as eciesKeys, using derive to get the shared secret
+func eciesKeysFrom(derive func(*Account, string) ([]byte, *[64]byte, error), private *Account, public string) ([]byte, error) {
+	secret, secretHash, err := derive(private, public)
+	if err != nil {
+		return nil, err
+	}
+	defer ZeroSecret(secret)
+	defer ZeroSecret(secretHash[:])
+	keys := sha512.Sum512(secretHash[:])
+	return keys[:], nil
+}
+
+// EciesEncryptStream is the same as EciesEncrypt, but reads the plaintext from r and writes the raw (not base64
+// encoded) message to w, so large payloads don't have to be held in memory. The IV is written first, followed by the
+// ciphertext as it is produced, and the HMAC once r returns io.EOF. The output can be base64 encoded and passed to
+// EciesDecrypt, or read with EciesDecryptStream.
+func EciesEncryptStream(sender *Account, recipientPub string, r io.Reader, w io.Writer) error {
+	keys, err := eciesKeys(sender, recipientPub)
+	if err != nil {
+		return err
+	}
+	defer ZeroSecret(keys)
+	iv := make([]byte, eciesIvLen)
+	if _, err = rand.Read(iv); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(keys[:32])
+	if err != nil {
+		return err
+	}
+	cbc := cipher.NewCBCEncrypter(block, iv)
+	signer := hmac.New(sha256.New, keys[32:])
+
+	// everything written is also added to the hmac
+	out := io.MultiWriter(w, signer)
+	if _, err = out.Write(iv); err != nil {
+		return err
 	}
 
-	return plainText[:len(plainText)-padLen], nil
+	buf := make([]byte, eciesStreamChunk+block.BlockSize())
+	pending := 0 // bytes at the start of buf not yet encrypted
+	for {
+		n, readErr := r.Read(buf[pending : pending+eciesStreamChunk])
+		pending += n
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if aligned := pending - pending%block.BlockSize(); aligned > 0 {
+			cbc.CryptBlocks(buf[:aligned], buf[:aligned])
+			if _, err = out.Write(buf[:aligned]); err != nil {
+				return err
+			}
+			pending = copy(buf, buf[aligned:pending])
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	// pkcs#7 pad whatever is left, which is always less than a block
+	padLen := block.BlockSize() - pending
+	for i := pending; i < block.BlockSize(); i++ {
+		buf[i] = uint8(padLen)
+	}
+	cbc.CryptBlocks(buf[:block.BlockSize()], buf[:block.BlockSize()])
+	if _, err = out.Write(buf[:block.BlockSize()]); err != nil {
+		return err
+	}
+	_, err = w.Write(signer.Sum(nil))
+	return err
+}
+
+// EciesDecryptStream is the inverse of EciesEncryptStream, reading a raw message from r and writing the plaintext to
+// w. The HMAC is at the end of the message, so it can only be checked after the plaintext has been written: if
+// ErrEciesHmac (or any other error) is returned, anything already written to w must be discarded.
+func EciesDecryptStream(recipient *Account, senderPub string, r io.Reader, w io.Writer) error {
+	keys, err := eciesKeys(recipient, senderPub)
+	if err != nil {
+		return err
+	}
+	defer ZeroSecret(keys)
+	iv := make([]byte, eciesIvLen)
+	if _, err = io.ReadFull(r, iv); err != nil {
+		return fmt.Errorf("message is too short, could not read IV: %w", err)
+	}
+	block, err := aes.NewCipher(keys[:32])
+	if err != nil {
+		return err
+	}
+	cbc := cipher.NewCBCDecrypter(block, iv)
+	verifier := hmac.New(sha256.New, keys[32:])
+	verifier.Write(iv)
+
+	// the hmac and the final (padded) block are held back until the end of the message is reached
+	holdBack := eciesSigLen + block.BlockSize()
+	buf := make([]byte, eciesStreamChunk+holdBack)
+	pending := 0
+	for {
+		n, readErr := r.Read(buf[pending:])
+		pending += n
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		if readErr == io.EOF {
+			break
+		}
+		ready := pending - holdBack
+		ready -= ready % block.BlockSize()
+		if ready <= 0 {
+			continue
+		}
+		verifier.Write(buf[:ready])
+		cbc.CryptBlocks(buf[:ready], buf[:ready])
+		if _, err = w.Write(buf[:ready]); err != nil {
+			return err
+		}
+		pending = copy(buf, buf[ready:pending])
+	}
+
+	cipherLen := pending - eciesSigLen
+	if cipherLen < block.BlockSize() || cipherLen%block.BlockSize() != 0 {
+		return errors.New("ciphertext is not block-aligned")
+	}
+	verifier.Write(buf[:cipherLen])
+	if !hmac.Equal(verifier.Sum(nil), buf[cipherLen:pending]) {
+		return ErrEciesHmac
+	}
+	cbc.CryptBlocks(buf[:cipherLen], buf[:cipherLen])
+	plainText, err := pkcs7Unpad(buf[:cipherLen], block.BlockSize())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(plainText)
+	return err
+}
+
+// pkcs7Unpad validates and removes PKCS#7 padding
+func pkcs7Unpad(padded []byte, blockSize int) ([]byte, error) {
+	if len(padded) == 0 || len(padded)%blockSize != 0 {
+		return nil, errors.New("invalid padding in message")
+	}
+	padLen := int(padded[len(padded)-1])
+	if padLen == 0 || padLen > blockSize || padLen > len(padded) {
+		return nil, errors.New("invalid padding in message")
+	}
+	for _, b := range padded[len(padded)-padLen:] {
+		if int(b) != padLen {
+			return nil, errors.New("invalid padding in message")
+		}
+	}
+	return padded[:len(padded)-padLen], nil
 }
 
 // depending on how the request was built it's possible to get a slightly different abi encoding,
@@ -533,14 +1206,35 @@ func tryDecryptRecord(bin []byte, obtType ObtType) (content *ObtRecordContent, e
 // in the OBT implementation, allowing the secret to be stretched into two keys, one for
 // encryption and one for message authentication.
 func EciesSecret(private *Account, public string) (secret []byte, hash *[64]byte, err error) {
+	return EciesSecretForKey(private, 0, public)
+}
+
+// ZeroSecret overwrites b with zeros. The encrypt and decrypt functions use it to wipe the shared secret and derived
+// keys once they are done, and callers of EciesSecret can do the same. This is best-effort: the garbage collector may
+// have already copied the memory, but wiping it shortens the time key material is left around.
+func ZeroSecret(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// EciesSecretForKey is the same as EciesSecret, but allows selecting which of the account's keys is used when the
+// KeyBag holds more than one.
+func EciesSecretForKey(private *Account, keyIndex int, public string) (secret []byte, hash *[64]byte, err error) {
+	if private == nil || private.KeyBag == nil || keyIndex < 0 || keyIndex >= len(private.KeyBag.Keys) {
+		return nil, nil, fmt.Errorf("key index %d is out of range", keyIndex)
+	}
 	// convert key to ecies private key type
-	wif, err := btcutil.DecodeWIF(private.KeyBag.Keys[0].String())
+	wif, err := btcutil.DecodeWIF(private.KeyBag.Keys[keyIndex].String())
 	if err != nil {
 		return nil, nil, err
 	}
 	priv := ecies.ImportECDSA(wif.PrivKey.ToECDSA())
 
-	// convert public key string into an ecies public key struct
+	// convert public key string into an ecies public key struct, legacy EOS prefixed keys are accepted
+	if strings.HasPrefix(public, "EOS") {
+		public = "FIO" + public[3:]
+	}
 	eosPub, err := ecc.NewPublicKey(public)
 	if err != nil {
 		return nil, nil, err
@@ -581,6 +1275,96 @@ type RequestStatus struct {
 	Content           string        `json:"content"`
 	TimeStamp         eos.JSONTime `json:"time_stamp"`
 	Status            string        `json:"status"`
+	// ContentType is not part of the API response, it is set based on the query used to fetch the request
+	ContentType ObtType `json:"-"`
+}
+
+// UnmarshalJSON decodes the time_stamp with ParseChainTime, which is more forgiving than eos.JSONTime
+func (rs *RequestStatus) UnmarshalJSON(data []byte) error {
+	type requestStatus RequestStatus
+	raw := struct {
+		*requestStatus
+		TimeStamp string `json:"time_stamp"`
+	}{requestStatus: (*requestStatus)(rs)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.TimeStamp == "" {
+		return nil
+	}
+	t, err := ParseChainTime(raw.TimeStamp)
+	if err != nil {
+		return fmt.Errorf("invalid time_stamp: %w", err)
+	}
+	rs.TimeStamp = eos.JSONTime{Time: t}
+	return nil
+}
+
+// Decrypt decrypts the content using the ContentType to choose between a request and a record. The account may be
+// either the payer or payee. If the type is not known, decoding as a record is attempted first, then as a request.
+func (rs RequestStatus) Decrypt(account *Account) (*ObtContentResult, error) {
+	otherPub := rs.PayeeFioPublicKey
+	if account.PubKey == rs.PayeeFioPublicKey {
+		otherPub = rs.PayerFioPublicKey
+	}
+	if rs.ContentType != ObtInvalidType {
+		return DecryptContent(account, otherPub, rs.Content, rs.ContentType)
+	}
+	if result, err := DecryptContent(account, otherPub, rs.Content, ObtResponseType); err == nil {
+		return result, nil
+	}
+	return DecryptContent(account, otherPub, rs.Content, ObtRequestType)
+}
+
+// DisplayRequest is a decrypted and flattened funds request, suitable for presenting in a list.
+type DisplayRequest struct {
+	FioRequestId uint64    `json:"fio_request_id"`
+	From         string    `json:"from"` // FIO address of the payee, who is requesting the funds
+	To           string    `json:"to"`   // FIO address of the payer
+	Amount       string    `json:"amount"`
+	ChainCode    string    `json:"chain_code"`
+	TokenCode    string    `json:"token_code"`
+	PayeeAddress string    `json:"payee_address"` // where funds should be sent on the requested chain
+	Memo         string    `json:"memo"`
+	Time         time.Time `json:"time"`
+	Status       string    `json:"status"`
+}
+
+// ToDisplay decrypts the content of a request and maps it to a DisplayRequest. The account may be either the payer
+// or the payee. FIO amounts are formatted using FormatFio, other amounts have the token code appended. The amount is
+// chosen by the sender, so a FIO amount that does not fit in a uint64 of SUFs, or has more than 9 decimal places, is
+// shown as-is rather than rounded.
+func (rs RequestStatus) ToDisplay(account *Account) (DisplayRequest, error) {
+	otherPub := rs.PayeeFioPublicKey
+	if account.PubKey == rs.PayeeFioPublicKey {
+		otherPub = rs.PayerFioPublicKey
+	}
+	decrypted, err := DecryptContent(account, otherPub, rs.Content, ObtRequestType)
+	if err != nil {
+		return DisplayRequest{}, err
+	}
+	req := decrypted.Request
+	amount := strings.TrimSpace(req.Amount + " " + req.TokenCode)
+	if strings.ToUpper(req.ChainCode) == "FIO" && strings.ToUpper(req.TokenCode) == "FIO" {
+		if d, e := decimal.NewFromString(req.Amount); e == nil && !d.IsNegative() {
+			suf := d.Shift(9)
+			if suf.Equal(suf.Truncate(0)) && suf.BigInt().IsUint64() {
+				amount = FormatFio(suf.BigInt().Uint64())
+			}
+		}
+	}
+	return DisplayRequest{
+		FioRequestId: rs.FioRequestId,
+		From:         rs.PayeeFioAddress,
+		To:           rs.PayerFioAddress,
+		Amount:       amount,
+		ChainCode:    req.ChainCode,
+		TokenCode:    req.TokenCode,
+		PayeeAddress: req.PayeePublicAddress,
+		Memo:         req.Memo,
+		Time:         rs.TimeStamp.Time,
+		Status:       rs.Status,
+	}, nil
 }
 
 // GetPendingFioRequests looks for pending requests
@@ -593,6 +1377,98 @@ func (api *API) GetSentFioRequests(pubKey string, limit int, offset int) (sentRe
 	return api.getFioRequests("sent", pubKey, limit, offset)
 }
 
+// fioRequestsBatch is the page size used by AllPendingFioRequests
+const fioRequestsBatch = 100
+
+// AllPendingFioRequests pages through GetPendingFioRequests until all pending requests are retrieved. An empty
+// slice and nil error are returned if there are no pending requests.
+func (api *API) AllPendingFioRequests(pubKey string) ([]RequestStatus, error) {
+	all := make([]RequestStatus, 0)
+	for offset := 0; ; offset += fioRequestsBatch {
+		page, _, err := api.GetPendingFioRequests(pubKey, fioRequestsBatch, offset)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, page.Requests...)
+		if len(page.Requests) < fioRequestsBatch {
+			return all, nil
+		}
+	}
+}
+
+// WatchPendingRequests polls for pending requests every interval and sends each request the first time it is
+// seen. Polling errors are ignored and retried on the next interval. The channel is closed when api.Close is called.
+func (api *API) WatchPendingRequests(pubKey string, interval time.Duration) (<-chan RequestStatus, error) {
+	if api.isClosed() {
+		return nil, ErrClosed
+	}
+	if interval <= 0 {
+		return nil, errors.New("interval must be greater than zero")
+	}
+	done := api.doneChan()
+	found := make(chan RequestStatus)
+	go func() {
+		defer close(found)
+		seen := make(map[uint64]bool)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			pending, err := api.AllPendingFioRequests(pubKey)
+			if err == nil {
+				for i := range pending {
+					if seen[pending[i].FioRequestId] {
+						continue
+					}
+					select {
+					case found <- pending[i]:
+						seen[pending[i].FioRequestId] = true
+					case <-done:
+						return
+					}
+				}
+			}
+			select {
+			case <-tick.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return found, nil
+}
+
+// DecryptedRequest is a pending request with its decrypted content. If the content could not be decrypted, Err is
+// set and Content is nil.
+type DecryptedRequest struct {
+	RequestStatus
+	Content *ObtRequestContent `json:"decrypted_content,omitempty"`
+	Err     error              `json:"-"`
+}
+
+// GetDecryptedPendingRequests fetches all pending requests for the account and decrypts them. A request that fails
+// to decrypt is still returned with Err populated, so one bad entry does not hide the others.
+func (api *API) GetDecryptedPendingRequests(account *Account) ([]DecryptedRequest, error) {
+	pending, err := api.AllPendingFioRequests(account.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]DecryptedRequest, len(pending))
+	for i := range pending {
+		decrypted[i].RequestStatus = pending[i]
+		result, err := pending[i].Decrypt(account)
+		if err != nil {
+			decrypted[i].Err = err
+			continue
+		}
+		if result.Request == nil {
+			decrypted[i].Err = errors.New("content did not decode as a request")
+			continue
+		}
+		decrypted[i].Content = result.Request
+	}
+	return decrypted, nil
+}
+
 func (api *API) getFioRequests(requestType string, pubKey string, limit int, offset int) (pendingRequests PendingFioRequestsResponse, hasPending bool, err error) {
 	query := getPendingFioNamesRequest{
 		FioPublicKey: pubKey,
@@ -630,9 +1506,71 @@ func (api *API) getFioRequests(requestType string, pubKey string, limit int, off
 	if len(pendingRequests.Requests) > 0 {
 		hasPending = true
 	}
+	for i := range pendingRequests.Requests {
+		pendingRequests.Requests[i].ContentType = ObtRequestType
+	}
 	return
 }
 
+// ObtDataResp holds the records returned by get_obt_data, these are the recordobt results written after an
+// off-chain transaction completes.
+type ObtDataResp struct {
+	ObtDataRecords []RequestStatus `json:"obt_data_records"`
+	More           int             `json:"more"`
+}
+
+// GetObtData retrieves recordobt data sent or received by the public key
+func (api *API) GetObtData(pubKey string, limit int, offset int) (obtData *ObtDataResp, found bool, err error) {
+	obtData = &ObtDataResp{}
+	err = api.call("chain", "get_obt_data", getPendingFioNamesRequest{
+		FioPublicKey: pubKey,
+		Limit:        limit,
+		Offset:       offset,
+	}, obtData)
+	if IsNotFound(err) {
+		return &ObtDataResp{}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range obtData.ObtDataRecords {
+		obtData.ObtDataRecords[i].ContentType = ObtResponseType
+	}
+	return obtData, len(obtData.ObtDataRecords) > 0, nil
+}
+
+// DecryptedRecord is an OBT record with its decrypted content. If the content could not be decrypted, Err is
+// set and Content is nil.
+type DecryptedRecord struct {
+	RequestStatus
+	Content *ObtRecordContent `json:"decrypted_content,omitempty"`
+	Err     error             `json:"-"`
+}
+
+// GetDecryptedObtData fetches OBT records for the account and decrypts them. A record that fails to decrypt is
+// still returned with Err populated.
+func (api *API) GetDecryptedObtData(account *Account, limit int, offset int) ([]DecryptedRecord, error) {
+	obtData, _, err := api.GetObtData(account.PubKey, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]DecryptedRecord, len(obtData.ObtDataRecords))
+	for i := range obtData.ObtDataRecords {
+		decrypted[i].RequestStatus = obtData.ObtDataRecords[i]
+		result, err := obtData.ObtDataRecords[i].Decrypt(account)
+		if err != nil {
+			decrypted[i].Err = err
+			continue
+		}
+		if result.Record == nil {
+			decrypted[i].Err = errors.New("content did not decode as a record")
+			continue
+		}
+		decrypted[i].Content = result.Record
+	}
+	return decrypted, nil
+}
+
 // FundsReqTableResp has the most useful fields of what is stored in the fioreqctxts table. It is slightly different
 // than what is sent from the API endpoint, but is useful when a specific request needs to be retrieved.
 type FundsReqTableResp struct {
@@ -752,6 +1690,93 @@ func (api *API) GetFioRequestStatus(requestId uint64) (hasResponse bool, request
 	return
 }
 
+// ReqObtContextRow is an unmodified row from the fioreqctxts table, with the matching fioreqstss row (if any)
+// attached as Status. It is intended for debugging, the typed getters should be preferred.
+type ReqObtContextRow struct {
+	FioRequestId          eos.Uint64  `json:"fio_request_id"`
+	PayerFioAddress       eos.Uint64  `json:"payer_fio_address"`
+	PayeeFioAddress       eos.Uint64  `json:"payee_fio_address"`
+	PayerFioAddressHexStr eos.Uint128 `json:"payer_fio_address_hex_str"`
+	PayeeFioAddressHexStr eos.Uint128 `json:"payee_fio_address_hex_str"`
+	PayerFioAddressTime   eos.Uint128 `json:"payer_fio_address_with_time"`
+	PayeeFioAddressTime   eos.Uint128 `json:"payee_fio_address_with_time"`
+	Content               string      `json:"content"`
+	TimeStamp             eos.Uint64  `json:"time_stamp"`
+	PayerFioAddr          string      `json:"payer_fio_addr"`
+	PayeeFioAddr          string      `json:"payee_fio_addr"`
+	PayerKey              string      `json:"payer_key"`
+	PayeeKey              string      `json:"payee_key"`
+
+	Status *FundsRequestStatusResp `json:"status,omitempty"`
+}
+
+// GetReqObtContexts returns raw rows from the fioreqctxts table with fio_request_id between lowerBound and upperBound,
+// an empty bound is unbounded. The status for each request is looked up from the fioreqstss table, requests
+// without a response will have a nil Status.
+func (api *API) GetReqObtContexts(lowerBound, upperBound string, limit int) ([]*ReqObtContextRow, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	resp, err := api.GetTableRows(eos.GetTableRowsRequest{
+		Code:       "fio.reqobt",
+		Scope:      "fio.reqobt",
+		Table:      "fioreqctxts",
+		LowerBound: lowerBound,
+		UpperBound: upperBound,
+		Limit:      uint32(limit),
+		KeyType:    "i64",
+		Index:      "1",
+		JSON:       true,
+		EncodeType: "dec",
+	})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]*ReqObtContextRow, 0)
+	if len(resp.Rows) < 3 {
+		return rows, nil
+	}
+	if err = json.Unmarshal(resp.Rows, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return rows, nil
+	}
+
+	statusResp, err := api.GetTableRows(eos.GetTableRowsRequest{
+		Code:       "fio.reqobt",
+		Scope:      "fio.reqobt",
+		Table:      "fioreqstss",
+		LowerBound: fmt.Sprintf("%d", rows[0].FioRequestId),
+		UpperBound: fmt.Sprintf("%d", rows[len(rows)-1].FioRequestId),
+		Limit:      uint32(limit),
+		KeyType:    "i64",
+		Index:      "2",
+		JSON:       true,
+		EncodeType: "dec",
+	})
+	if err != nil {
+		return rows, err
+	}
+	if len(statusResp.Rows) < 3 {
+		return rows, nil
+	}
+	statuses := make([]*FundsRequestStatusResp, 0)
+	if err = json.Unmarshal(statusResp.Rows, &statuses); err != nil {
+		return rows, err
+	}
+	byId := make(map[uint64]*FundsRequestStatusResp)
+	for _, st := range statuses {
+		if st != nil {
+			byId[st.FioRequestId] = st
+		}
+	}
+	for _, row := range rows {
+		row.Status = byId[uint64(row.FioRequestId)]
+	}
+	return rows, nil
+}
+
 // ObtAbiJson defines the ABI format for OBT requests. There are two variations used in fio-go, one that has
 // optional fields (obtAbiJsonOmit) which is private, and one that does not. The variations are tried in sequence to help
 // with compatibility with different wallet implementations. Under normal circumstances, ObtAbiJson is the correct choice.
@@ -2,9 +2,20 @@ package fio
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/fioprotocol/fio-go/eos"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -245,25 +256,55 @@ func TestEciesSecret2(t *testing.T) {
 	if !bytes.Equal(secretHash[:], secretHash2[:]) {
 		t.Error("bob and alice didn't agree on a shared secret")
 	}
+
+	// Check the cipher text, using the same IV and serialized new_funds_content
+	iv, _ := hex.DecodeString(expectCipherText[:32])
+	plainText := []byte("\vpurse.alice\x011\nfio.reqobt\x00\x00\x00")
+	content, err := EciesEncryptWithIV(alice, bob.PubKey, plainText, iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipherText, _ := base64.StdEncoding.DecodeString(content)
+	if hex.EncodeToString(cipherText) != expectCipherText {
+		t.Error("cipher text does not match expected (hard-coded) value")
+	}
+	decrypted, err := EciesDecrypt(bob, alice.PubKey, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plainText) {
+		t.Error("known vector did not decrypt to expected value")
+	}
+
+	if _, err = EciesEncryptWithIV(alice, bob.PubKey, plainText, iv[:15]); err == nil {
+		t.Error("expected an error for a short IV")
+	}
 }
 
 func TestEncryptDecrypt(t *testing.T) {
-	rand.Seed(time.Now().UnixNano())
+	// keys and data come from a logged seed so that a failure can be replayed
+	seed := time.Now().UnixNano()
+	rng := rand.New(rand.NewSource(seed))
+	defer func() {
+		if t.Failed() {
+			t.Logf("replay with seed %d", seed)
+		}
+	}()
 	// run through it several times with random data, keys, and length to ensure padding, etc works.
 	for i := 0; i < 40; i++ {
-		size := rand.Intn(128) + 128
+		size := rng.Intn(128) + 128
 		someData := make([]byte, size)
-		_, e := rand.Read(someData)
+		_, e := rng.Read(someData)
 		if e != nil {
 			t.Error(e.Error())
 			return
 		}
-		sender, e := NewRandomAccount()
+		sender, e := NewRandomAccountSeeded(rng)
 		if e != nil {
 			t.Error(e.Error())
 			return
 		}
-		recipient, e := NewRandomAccount()
+		recipient, e := NewRandomAccountSeeded(rng)
 		if e != nil {
 			t.Error(e.Error())
 			return
@@ -292,7 +333,8 @@ func TestEncryptDecrypt(t *testing.T) {
 			PayerPublicAddress: "aaaaaaaaaa",
 			PayeePublicAddress: "bbbbbbbbbb",
 			Amount:             "1111111111",
-			TokenCode:          "zzzzzzzzzz",
+			ChainCode:          "ZZZZZZZZZZ",
+			TokenCode:          "ZZZZZZZZZZ",
 			Status:             "xxxxxxxxxx",
 			ObtId:              "2222222222",
 			Memo:               "ffffffffff",
@@ -321,3 +363,1233 @@ func TestEncryptDecrypt(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitMemo(t *testing.T) {
+	store := make(map[string][]byte)
+	upload := func(memo []byte) (string, error) {
+		url := fmt.Sprintf("https://example.com/memo/%d", len(store))
+		store[url] = memo
+		return url, nil
+	}
+	fetch := func(url string) ([]byte, error) {
+		return store[url], nil
+	}
+
+	long := ""
+	for len(long) <= ObtMemoMaxLen*2 {
+		long += "invoice line item é "
+	}
+	req := &ObtRequestContent{Memo: long}
+	if err := req.SplitMemo(upload); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Memo) > ObtMemoMaxLen || req.OfflineUrl == "" || req.Hash == "" {
+		t.Fatalf("memo was not split: %+v", req)
+	}
+	full, err := VerifyAndFetchMemo(req.Memo, req.Hash, req.OfflineUrl, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full != long {
+		t.Error("reassembled memo did not match original")
+	}
+
+	// tampered content must be rejected
+	store[req.OfflineUrl] = []byte("something else")
+	if _, err = VerifyAndFetchMemo(req.Memo, req.Hash, req.OfflineUrl, fetch); err == nil {
+		t.Error("expected hash mismatch")
+	}
+
+	// short memos are left alone
+	rec := &ObtRecordContent{Memo: "short"}
+	if err = rec.SplitMemo(nil); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Memo != "short" || rec.OfflineUrl != "" || rec.Hash != "" {
+		t.Error("short memo should not be modified")
+	}
+	req = &ObtRequestContent{Memo: "short", Hash: "abcd", OfflineUrl: "https://example.com/invoice"}
+	if err = req.SplitMemo(upload); err != nil {
+		t.Fatal(err)
+	}
+	if req.Memo != "short" || req.Hash != "abcd" || req.OfflineUrl != "https://example.com/invoice" {
+		t.Error("existing hash and offline url should be kept when the memo fits")
+	}
+}
+
+func TestObtIdempotency(t *testing.T) {
+	idem := NewObtIdempotency(time.Minute, 2)
+	var pushed int
+	push := func() (*eos.PushTransactionFullResp, error) {
+		pushed += 1
+		return &eos.PushTransactionFullResp{TransactionID: fmt.Sprintf("%d", pushed)}, nil
+	}
+
+	first, dup, err := idem.Do("request-1", push)
+	if err != nil || dup {
+		t.Fatal("first send should not be a duplicate", err)
+	}
+	second, dup, err := idem.Do("request-1", push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dup || pushed != 1 || second.TransactionID != first.TransactionID {
+		t.Error("second send with the same key should have returned the prior result")
+	}
+
+	// failures are not remembered
+	_, _, err = idem.Do("request-2", func() (*eos.PushTransactionFullResp, error) {
+		return nil, errors.New("push failed")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if _, dup, _ = idem.Do("request-2", push); dup {
+		t.Error("failed send should be retried")
+	}
+
+	// bounded: request-1 is the oldest and should be evicted
+	if _, dup, _ = idem.Do("request-3", push); dup {
+		t.Error("new key reported as a duplicate")
+	}
+	if _, dup, _ = idem.Do("request-1", push); dup {
+		t.Error("oldest key should have been evicted")
+	}
+}
+
+func TestObtIdempotency_inFlight(t *testing.T) {
+	idem := NewObtIdempotency(time.Minute, 1)
+	var pushed int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slow := func() (*eos.PushTransactionFullResp, error) {
+		atomic.AddInt32(&pushed, 1)
+		close(started)
+		<-release
+		return &eos.PushTransactionFullResp{TransactionID: "slow"}, nil
+	}
+	fast := func() (*eos.PushTransactionFullResp, error) {
+		return &eos.PushTransactionFullResp{TransactionID: "fast"}, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_, _, _ = idem.Do("request-1", slow)
+		close(done)
+	}()
+	<-started
+
+	// at capacity, but the in-flight key must not be evicted
+	if _, _, err := idem.Do("request-2", fast); err != nil {
+		t.Fatal(err)
+	}
+	dupResult := make(chan bool)
+	go func() {
+		_, dup, _ := idem.Do("request-1", slow)
+		dupResult <- dup
+	}()
+	close(release)
+	<-done
+	if !<-dupResult || atomic.LoadInt32(&pushed) != 1 {
+		t.Errorf("in-flight key was pushed again, %d pushes", atomic.LoadInt32(&pushed))
+	}
+
+	// a panicking push must not leave waiters blocked
+	func() {
+		defer func() { _ = recover() }()
+		_, _, _ = idem.Do("request-3", func() (*eos.PushTransactionFullResp, error) {
+			panic("push failed")
+		})
+	}()
+	result := make(chan bool)
+	go func() {
+		_, dup, err := idem.Do("request-3", fast)
+		result <- dup || err != nil
+	}()
+	select {
+	case failed := <-result:
+		if failed {
+			t.Error("key should have been forgotten after the panic")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do blocked after a panicking push")
+	}
+}
+
+func TestRequestStatus_ToDisplay(t *testing.T) {
+	payee, _ := NewRandomAccount()
+	payer, _ := NewRandomAccount()
+	content, err := ObtRequestContent{
+		PayeePublicAddress: payee.PubKey,
+		Amount:             "12.5",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Memo:               "lunch",
+	}.Encrypt(payee, payer.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	rs := RequestStatus{
+		FioRequestId:      42,
+		PayerFioAddress:   "payer@fiotestnet",
+		PayeeFioAddress:   "payee@fiotestnet",
+		PayerFioPublicKey: payer.PubKey,
+		PayeeFioPublicKey: payee.PubKey,
+		Content:           content,
+		TimeStamp:         eos.JSONTime{Time: ts},
+		Status:            "requested",
+	}
+
+	// both sides should be able to decrypt it
+	for _, acc := range []*Account{payer, payee} {
+		d, err := rs.ToDisplay(acc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.FioRequestId != 42 || d.From != "payee@fiotestnet" || d.To != "payer@fiotestnet" || d.Memo != "lunch" ||
+			d.Amount != "12.5 FIO" || !d.Time.Equal(ts) || d.Status != "requested" || d.PayeeAddress != payee.PubKey {
+			t.Errorf("unexpected display request: %+v", d)
+		}
+	}
+
+	// amounts that can't be represented in SUFs are shown as sent, not wrapped or truncated
+	for amount, expect := range map[string]string{
+		"18446744073.709551615": "18446744073.709551615 FIO",
+		"18446744078.709551616": "18446744078.709551616 FIO",
+		"1.0000000005":          "1.0000000005 FIO",
+		"1.000000000":           "1 FIO",
+	} {
+		rs.Content, err = ObtRequestContent{
+			PayeePublicAddress: payee.PubKey,
+			Amount:             amount,
+			ChainCode:          "FIO",
+			TokenCode:          "FIO",
+		}.Encrypt(payee, payer.PubKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := rs.ToDisplay(payer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Amount != expect {
+			t.Errorf("%s: expected %q, got %q", amount, expect, d.Amount)
+		}
+	}
+}
+
+func TestContentToURL(t *testing.T) {
+	sender, _ := NewRandomAccount()
+	recipient, _ := NewRandomAccount()
+	content, err := ObtRequestContent{
+		PayeePublicAddress: sender.PubKey,
+		Amount:             "1",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Memo:               "shared via qr code",
+	}.Encrypt(sender, recipient.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := ContentToURL(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u) > len(content) || strings.ContainsAny(u, "+/=") {
+		t.Error("url encoding was not compact and url-safe:", u)
+	}
+	back, err := ContentFromURL(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back != content {
+		t.Error("content did not survive round-trip")
+	}
+	decrypted, err := DecryptContent(recipient, sender.PubKey, back, ObtRequestType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Request.Memo != "shared via qr code" {
+		t.Error("decrypted content did not match")
+	}
+}
+
+func TestRequestStatus_Decrypt(t *testing.T) {
+	payee, _ := NewRandomAccount()
+	payer, _ := NewRandomAccount()
+	reqContent, err := ObtRequestContent{
+		PayeePublicAddress: payee.PubKey,
+		Amount:             "1",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Memo:               "a request",
+	}.Encrypt(payee, payer.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recContent, err := ObtRecordContent{
+		PayerPublicAddress: payer.PubKey,
+		PayeePublicAddress: payee.PubKey,
+		Amount:             "1",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Status:             "sent_to_blockchain",
+		ObtId:              "abc123",
+		Memo:               "a record",
+	}.Encrypt(payer, payee.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := []RequestStatus{
+		{PayerFioPublicKey: payer.PubKey, PayeeFioPublicKey: payee.PubKey, Content: reqContent, ContentType: ObtTypeFromAction("newfundsreq")},
+		{PayerFioPublicKey: payer.PubKey, PayeeFioPublicKey: payee.PubKey, Content: recContent, ContentType: ObtTypeFromAction("recordobt")},
+	}
+	for _, acc := range []*Account{payer, payee} {
+		first, err := list[0].Decrypt(acc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.Type != ObtRequestType || first.Request == nil || first.Request.Memo != "a request" {
+			t.Error("request did not decrypt as a request")
+		}
+		second, err := list[1].Decrypt(acc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.Type != ObtResponseType || second.Record == nil || second.Record.ObtId != "abc123" {
+			t.Error("record did not decrypt as a record")
+		}
+	}
+
+	// without a type, the record should still be detected
+	list[1].ContentType = ObtInvalidType
+	rec, err := list[1].Decrypt(payee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Type != ObtResponseType || rec.Record.Memo != "a record" {
+		t.Error("record was not detected")
+	}
+	if ObtTypeFromAction("regaddress") != ObtInvalidType {
+		t.Error("unexpected type for non-obt action")
+	}
+}
+
+func TestEciesDecrypt_invalid(t *testing.T) {
+	sender, _ := NewRandomAccount()
+	recipient, _ := NewRandomAccount()
+	content, err := EciesEncrypt(sender, recipient.PubKey, []byte("hello"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, _ := base64.StdEncoding.DecodeString(content)
+
+	// truncated input must return an error, not panic
+	for _, l := range []int{0, 1, 16, 47} {
+		if _, err = EciesDecrypt(recipient, sender.PubKey, base64.StdEncoding.EncodeToString(bin[:l])); err == nil {
+			t.Errorf("expected an error for a %d byte message", l)
+		}
+	}
+
+	// a misaligned ciphertext with a valid hmac is rejected without panicking
+	_, secretHash, _ := EciesSecret(sender, recipient.PubKey)
+	keys := sha512.Sum512(secretHash[:])
+	misaligned := append(append([]byte{}, bin[:len(bin)-32]...), 1, 2, 3)
+	mac := hmac.New(sha256.New, keys[32:])
+	mac.Write(misaligned)
+	misaligned = mac.Sum(misaligned)
+	_, err = EciesDecrypt(recipient, sender.PubKey, base64.StdEncoding.EncodeToString(misaligned))
+	if err == nil || err.Error() != "ciphertext is not block-aligned" {
+		t.Error("expected block alignment error, got:", err)
+	}
+
+	// a modified hmac is rejected
+	tampered := append([]byte{}, bin...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err = EciesDecrypt(recipient, sender.PubKey, base64.StdEncoding.EncodeToString(tampered)); err == nil {
+		t.Error("expected an error for an invalid hmac")
+	}
+}
+
+func TestPkcs7Unpad(t *testing.T) {
+	good := append([]byte("0123456789ab"), 4, 4, 4, 4)
+	out, err := pkcs7Unpad(good, 16)
+	if err != nil || string(out) != "0123456789ab" {
+		t.Error("valid padding was rejected", err)
+	}
+	full := append([]byte("0123456789abcdef"), bytes.Repeat([]byte{16}, 16)...)
+	if out, err = pkcs7Unpad(full, 16); err != nil || string(out) != "0123456789abcdef" {
+		t.Error("full block of padding was rejected", err)
+	}
+
+	for name, bad := range map[string][]byte{
+		"zero pad length":      append([]byte("0123456789abcde"), 0),
+		"pad length too large": append([]byte("0123456789abcde"), 17),
+		"inconsistent pad":     append([]byte("0123456789ab"), 4, 3, 4, 4),
+		"empty":                {},
+		"not block aligned":    append([]byte("0123456789a"), 4, 4, 4, 4),
+	} {
+		if _, err = pkcs7Unpad(bad, 16); err == nil || err.Error() != "invalid padding in message" {
+			t.Errorf("%s: expected invalid padding error, got %v", name, err)
+		}
+	}
+}
+
+func TestEciesSecretForKey(t *testing.T) {
+	alice, _ := NewAccountFromWif("5J9bWm2ThenDm3tjvmUgHtWCVMUdjRR1pxnRtnJjvKA4b2ut5WK")
+	bob, _ := NewAccountFromWif("5JoQtsKQuH8hC9MyvfJAqo6qmKLm8ePYNucs7tPu2YxG12trzBt")
+	carol, _ := NewRandomAccount()
+
+	// give alice a second key
+	if err := alice.KeyBag.Add(carol.KeyBag.Keys[0].String()); err != nil {
+		t.Fatal(err)
+	}
+	_, first, err := EciesSecretForKey(alice, 0, bob.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, def, _ := EciesSecret(alice, bob.PubKey)
+	if !bytes.Equal(first[:], def[:]) {
+		t.Error("EciesSecret should use the first key")
+	}
+	_, second, err := EciesSecretForKey(alice, 1, bob.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, expect, _ := EciesSecret(carol, bob.PubKey)
+	if !bytes.Equal(second[:], expect[:]) {
+		t.Error("second key did not derive the expected secret")
+	}
+	if _, _, err = EciesSecretForKey(alice, 2, bob.PubKey); err == nil {
+		t.Error("expected an error for an out of range key index")
+	}
+	if _, _, err = EciesSecretForKey(alice, -1, bob.PubKey); err == nil {
+		t.Error("expected an error for a negative key index")
+	}
+}
+
+func TestEciesSecret_keyPrefix(t *testing.T) {
+	alice, _ := NewAccountFromWif("5J9bWm2ThenDm3tjvmUgHtWCVMUdjRR1pxnRtnJjvKA4b2ut5WK")
+	bob, _ := NewAccountFromWif("5JoQtsKQuH8hC9MyvfJAqo6qmKLm8ePYNucs7tPu2YxG12trzBt")
+
+	_, fioHash, err := EciesSecret(alice, bob.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, eosHash, err := EciesSecret(alice, "EOS"+bob.PubKey[3:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fioHash[:], eosHash[:]) {
+		t.Error("FIO and EOS prefixed keys should derive the same secret")
+	}
+	for _, bad := range []string{"", "EO", "EOS", "XYZ" + bob.PubKey[3:], bob.PubKey[:20]} {
+		if _, _, err = EciesSecret(alice, bad); err == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestReEncryptContent(t *testing.T) {
+	alice, _ := NewRandomAccount()
+	bob, _ := NewRandomAccount()
+	bobNew, _ := NewRandomAccount()
+
+	content, err := ObtRequestContent{
+		PayeePublicAddress: alice.PubKey,
+		Amount:             "3",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Memo:               "before rotation",
+	}.Encrypt(alice, bob.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := ReEncryptContent(bob, alice.PubKey, []byte(content), bobNew.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rotated) == content {
+		t.Error("content was not re-encrypted")
+	}
+	decrypted, err := DecryptContent(bobNew, bob.PubKey, string(rotated), ObtRequestType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Request.Memo != "before rotation" || decrypted.Request.Amount != "3" {
+		t.Error("re-encrypted content did not match original")
+	}
+	if _, err = DecryptContent(bobNew, alice.PubKey, string(rotated), ObtRequestType); err == nil {
+		t.Error("rotated content should not decrypt using the original sender's key")
+	}
+}
+
+func TestEncryptABI(t *testing.T) {
+	// payee "purse.alice", amount "1", chain and token "FIO", optional fields absent
+	const vector = "0b70757273652e616c69636501310346494f0346494f000000"
+	req := ObtRequestContent{
+		PayeePublicAddress: "purse.alice",
+		Amount:             "1",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+	}
+	bin, err := req.EncodeABI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(bin) != vector {
+		t.Errorf("unexpected encoding: got %x, want %s", bin, vector)
+	}
+
+	alice, _ := NewRandomAccount()
+	bob, _ := NewRandomAccount()
+	j := []byte(`{"payee_public_address":"purse.alice","amount":"1","chain_code":"FIO","token_code":"FIO"}`)
+	encrypted, err := EncryptABI(alice, bob.PubKey, ObtRequestType, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := EciesDecrypt(bob, alice.PubKey, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(plain) != vector {
+		t.Errorf("EncryptABI did not use the ABI encoding: got %x", plain)
+	}
+	decrypted, err := DecryptABI(bob, alice.PubKey, encrypted, ObtRequestType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(decrypted, []byte(`"payee_public_address":"purse.alice"`)) {
+		t.Errorf("unexpected decrypted json: %s", string(decrypted))
+	}
+	legacy, err := DecryptContent(bob, alice.PubKey, encrypted, ObtRequestType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Request.ChainCode != "FIO" {
+		t.Error("content from EncryptABI should decrypt with DecryptContent")
+	}
+	if _, err = EncryptABI(alice, bob.PubKey, ObtType(99), j); err == nil {
+		t.Error("expected error for unknown obt type")
+	}
+	oversized := []byte(`{"payee_public_address":"purse.alice","amount":"1","chain_code":"FIO","token_code":"FIO","memo":"` +
+		strings.Repeat("m", 300) + `"}`)
+	if _, err = EncryptABI(alice, bob.PubKey, ObtRequestType, oversized); !errors.Is(err, ErrContentTooLarge) {
+		t.Errorf("expected ErrContentTooLarge for an oversized memo, got %v", err)
+	}
+}
+
+func TestAPI_GetReqObtContexts(t *testing.T) {
+	const ctxRow = `{"rows":[{"fio_request_id":7,"payer_fio_address":"12345678901234567890","payee_fio_address":42,` +
+		`"payer_fio_address_hex_str":"0x0102030405060708090a0b0c0d0e0f10","payee_fio_address_hex_str":"0x00000000000000000000000000000001",` +
+		`"payer_fio_address_with_time":"0x00000000000000000000000000000002","payee_fio_address_with_time":"0x00000000000000000000000000000003",` +
+		`"content":"abc=","time_stamp":1600000000,"payer_fio_addr":"alice@fiotestnet","payee_fio_addr":"bob@fiotestnet",` +
+		`"payer_key":"FIO6G9pXXM92Gy5eMwNquGULoCj3ZStwPLPdEb9mVXyEHqWN7HSuA","payee_key":"FIO7uRvrLVrZCbCM2DtCgUMospqUMnP3JUC1sKHA8zNoF835kJBvN"},` +
+		`{"fio_request_id":8,"payer_fio_address":1,"payee_fio_address":2,"payer_fio_address_hex_str":"0x00000000000000000000000000000000","payee_fio_address_hex_str":"0x00000000000000000000000000000000",` +
+		`"payer_fio_address_with_time":"0x00000000000000000000000000000000","payee_fio_address_with_time":"0x00000000000000000000000000000000","content":"","time_stamp":1600000001,` +
+		`"payer_fio_addr":"","payee_fio_addr":"","payer_key":"","payee_key":""}],"more":false}`
+	const statusRow = `{"rows":[{"id":0,"fio_request_id":7,"status":2,"metadata":"","time_stamp":1600000100}],"more":false}`
+
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case bytes.Contains(body, []byte(`"fioreqctxts"`)):
+			_, _ = w.Write([]byte(ctxRow))
+		case bytes.Contains(body, []byte(`"fioreqstss"`)):
+			_, _ = w.Write([]byte(statusRow))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	rows, err := api.GetReqObtContexts("7", "8", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].FioRequestId != 7 || rows[0].PayerFioAddress != 12345678901234567890 || rows[0].PayeeFioAddress != 42 {
+		t.Errorf("ids were not decoded: %+v", rows[0])
+	}
+	if rows[0].PayerFioAddressHexStr.String() != "0x0102030405060708090a0b0c0d0e0f10" {
+		t.Errorf("unexpected payer hash %s", rows[0].PayerFioAddressHexStr.String())
+	}
+	if rows[0].Content != "abc=" || rows[0].PayeeFioAddr != "bob@fiotestnet" {
+		t.Error("row fields were not decoded")
+	}
+	if rows[0].Status == nil || rows[0].Status.Status != 2 {
+		t.Error("expected status to be attached to request 7")
+	}
+	if rows[1].Status != nil {
+		t.Error("request 8 should not have a status")
+	}
+}
+
+func TestNewCancelFndReq(t *testing.T) {
+	prev := CurrentTpid()
+	defer SetTpid(prev)
+	SetTpid("tpid@fiotestnet")
+
+	act := NewCancelFndReq("htjonrkf1lgs", 12345)
+	if act.Account != "fio.reqobt" || act.Name != "cancelfndreq" {
+		t.Errorf("wrong contract or action: %s::%s", act.Account, act.Name)
+	}
+	data := act.Data.(CancelFndReq)
+	if data.FioRequestId != "12345" || data.Actor != "htjonrkf1lgs" || data.Tpid != "tpid@fiotestnet" {
+		t.Errorf("unexpected action data: %+v", data)
+	}
+	if data.MaxFee != Tokens(GetMaxFee(FeeCancelFundsRequest)) {
+		t.Error("max fee was not populated")
+	}
+	bin, err := eos.MarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{5}, []byte("12345")...)
+	if !bytes.HasPrefix(bin, want) {
+		t.Errorf("request id was not serialized first: %x", bin)
+	}
+}
+
+func TestAPI_AllPendingFioRequests(t *testing.T) {
+	const total = 250
+	var calls int
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_pending_fio_requests" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		calls++
+		q := getPendingFioNamesRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&q)
+		if q.FioPublicKey == "FIO5nobody" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"No requests"}`))
+			return
+		}
+		resp := PendingFioRequestsResponse{Requests: make([]RequestStatus, 0)}
+		for i := q.Offset; i < total && i < q.Offset+q.Limit; i++ {
+			resp.Requests = append(resp.Requests, RequestStatus{FioRequestId: uint64(i)})
+		}
+		resp.More = total - q.Offset - len(resp.Requests)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	reqs, err := api.AllPendingFioRequests("FIO5somebody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != total || calls != 3 {
+		t.Errorf("expected %d requests in 3 calls, got %d in %d", total, len(reqs), calls)
+	}
+	for i := range reqs {
+		if reqs[i].FioRequestId != uint64(i) {
+			t.Fatalf("request %d out of order", i)
+		}
+		if reqs[i].ContentType != ObtRequestType {
+			t.Fatal("content type was not set")
+		}
+	}
+
+	reqs, err = api.AllPendingFioRequests("FIO5nobody")
+	if err != nil {
+		t.Error(err)
+	}
+	if reqs == nil || len(reqs) != 0 {
+		t.Error("expected an empty slice when there are no requests")
+	}
+}
+
+func TestVerifyEciesHmac(t *testing.T) {
+	alice, _ := NewRandomAccount()
+	bob, _ := NewRandomAccount()
+	content, err := EciesEncrypt(alice, bob.PubKey, []byte("integrity check"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := VerifyEciesHmac(bob, alice.PubKey, []byte(content))
+	if err != nil || !ok {
+		t.Errorf("valid message did not verify: %v", err)
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(content)
+	raw[eciesIvLen] ^= 0x01
+	tampered := base64.StdEncoding.EncodeToString(raw)
+	ok, err = VerifyEciesHmac(bob, alice.PubKey, []byte(tampered))
+	if err != nil || ok {
+		t.Errorf("tampered message should fail verification without an error, got %v %v", ok, err)
+	}
+	if _, err = EciesDecrypt(bob, alice.PubKey, tampered); err != ErrEciesHmac {
+		t.Errorf("expected ErrEciesHmac from EciesDecrypt, got %v", err)
+	}
+
+	if _, err = VerifyEciesHmac(bob, alice.PubKey, []byte("c2hvcnQ=")); err == nil {
+		t.Error("expected an error for a short message")
+	}
+}
+
+func TestAPI_GetDecryptedPendingRequests(t *testing.T) {
+	payee, _ := NewRandomAccount()
+	var pending []RequestStatus
+	payer, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(PendingFioRequestsResponse{Requests: pending})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	good, err := ObtRequestContent{
+		PayeePublicAddress: payee.PubKey,
+		Amount:             "2",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Memo:               "pending",
+	}.Encrypt(payee, payer.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending = []RequestStatus{
+		{FioRequestId: 1, PayerFioPublicKey: payer.PubKey, PayeeFioPublicKey: payee.PubKey, Content: good},
+		{FioRequestId: 2, PayerFioPublicKey: payer.PubKey, PayeeFioPublicKey: payee.PubKey, Content: "bm90IGVuY3J5cHRlZA=="},
+	}
+
+	reqs, err := api.GetDecryptedPendingRequests(payer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	if reqs[0].Err != nil || reqs[0].Content == nil || reqs[0].Content.Memo != "pending" {
+		t.Errorf("first request did not decrypt: %v", reqs[0].Err)
+	}
+	if reqs[1].Err == nil || reqs[1].Content != nil || reqs[1].FioRequestId != 2 {
+		t.Error("corrupt request should be returned with an error")
+	}
+}
+
+func TestNewRequestActionsByID(t *testing.T) {
+	const id = uint64(18446744073709551615)
+	reject := NewRejectFndReqByID("htjonrkf1lgs", id)
+	if reject.Name != "rejectfndreq" || reject.Data.(RejectFndReq).FioRequestId != "18446744073709551615" {
+		t.Errorf("reject action was not built correctly: %+v", reject.Data)
+	}
+	record := NewRecordSendByID("htjonrkf1lgs", 42, "alice@fiotestnet", "bob@fiotestnet", "abc=")
+	rs := record.Data.(RecordSend)
+	if record.Name != "recordobt" || rs.FioRequestId != "42" || rs.PayerFioAddress != "alice@fiotestnet" || rs.Content != "abc=" {
+		t.Errorf("record action was not built correctly: %+v", rs)
+	}
+	if NewRecordObt("htjonrkf1lgs", "alice@fiotestnet", "bob@fiotestnet", "abc=").Data.(RecordSend).FioRequestId != "" {
+		t.Error("standalone record should not have a request id")
+	}
+}
+
+func TestAPI_GetObtData(t *testing.T) {
+	payer, _ := NewRandomAccount()
+	var records []RequestStatus
+	var failing bool
+	payee, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_obt_data" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"code":500,"message":"Internal Service Error","error":{"code":3010000,"name":"chain_type_exception","what":"chain type exception","details":[]}}`))
+			return
+		}
+		if len(records) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"No FIO Requests"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(ObtDataResp{ObtDataRecords: records})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// a failing node is an error, not an empty result
+	failing = true
+	if _, found, err := api.GetObtData(payee.PubKey, 10, 0); err == nil || found {
+		t.Error("expected an error for a failed request")
+	}
+	failing = false
+
+	_, found, err := api.GetObtData(payee.PubKey, 10, 0)
+	if err != nil || found {
+		t.Errorf("expected no records and no error, got %v %v", found, err)
+	}
+
+	content, err := ObtRecordContent{
+		PayerPublicAddress: payer.PubKey,
+		PayeePublicAddress: payee.PubKey,
+		Amount:             "4",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Status:             "sent_to_blockchain",
+		ObtId:              "abc123",
+	}.Encrypt(payer, payee.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = []RequestStatus{
+		{FioRequestId: 3, PayerFioPublicKey: payer.PubKey, PayeeFioPublicKey: payee.PubKey, Content: content, Status: "sent_to_blockchain"},
+		{FioRequestId: 4, PayerFioPublicKey: payer.PubKey, PayeeFioPublicKey: payee.PubKey, Content: "bm90IGVuY3J5cHRlZA=="},
+	}
+	obtData, found, err := api.GetObtData(payee.PubKey, 10, 0)
+	if err != nil || !found || len(obtData.ObtDataRecords) != 2 {
+		t.Fatalf("expected 2 records: %v", err)
+	}
+	if obtData.ObtDataRecords[0].ContentType != ObtResponseType {
+		t.Error("content type was not set")
+	}
+
+	decrypted, err := api.GetDecryptedObtData(payee, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted[0].Err != nil || decrypted[0].Content == nil || decrypted[0].Content.ObtId != "abc123" {
+		t.Errorf("record did not decrypt: %v", decrypted[0].Err)
+	}
+	if decrypted[1].Err == nil {
+		t.Error("corrupt record should be returned with an error")
+	}
+}
+
+func TestErrContentTooLarge(t *testing.T) {
+	alice, _ := NewRandomAccount()
+	bob, _ := NewRandomAccount()
+	for _, l := range []int{0, 15, 16, 17, 100} {
+		content, err := EciesEncrypt(alice, bob.PubKey, make([]byte, l), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) != EciesEncryptedLen(l) {
+			t.Errorf("EciesEncryptedLen(%d) = %d, actual %d", l, EciesEncryptedLen(l), len(content))
+		}
+	}
+
+	req := ObtRequestContent{
+		PayeePublicAddress: alice.PubKey,
+		Amount:             "1",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Memo:               strings.Repeat("m", 200),
+	}
+	if _, err := req.Encrypt(alice, bob.PubKey); !errors.Is(err, ErrContentTooLarge) {
+		t.Errorf("expected ErrContentTooLarge, got %v", err)
+	}
+	req.Memo = "fits"
+	if _, err := req.Encrypt(alice, bob.PubKey); err != nil {
+		t.Error(err)
+	}
+
+	rec := ObtRecordContent{
+		PayerPublicAddress: alice.PubKey,
+		PayeePublicAddress: bob.PubKey,
+		Amount:             "1",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		ObtId:              strings.Repeat("0", 300),
+	}
+	if _, err := rec.Encrypt(alice, bob.PubKey); !errors.Is(err, ErrContentTooLarge) {
+		t.Errorf("expected ErrContentTooLarge for record, got %v", err)
+	}
+}
+
+func TestObtContent_AmountDecimal(t *testing.T) {
+	req := &ObtRequestContent{Amount: " 1.5 "}
+	d, err := req.AmountDecimal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.String() != "1.5" {
+		t.Errorf("expected 1.5, got %s", d.String())
+	}
+	for _, bad := range []string{"", "abc", "1,5", "-1"} {
+		req.Amount = bad
+		if _, err = req.AmountDecimal(); err == nil {
+			t.Errorf("expected error for amount %q", bad)
+		}
+	}
+
+	rec := &ObtRecordContent{Amount: "0.000000001"}
+	if d, err = rec.AmountDecimal(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Shift(9).IntPart() != 1 {
+		t.Errorf("expected 1 suf, got %s", d.Shift(9).String())
+	}
+	rec.Amount = "ten"
+	if _, err = rec.AmountDecimal(); err == nil {
+		t.Error("expected error for non-numeric record amount")
+	}
+}
+
+func TestObtContent_Normalize(t *testing.T) {
+	alice, _ := NewRandomAccount()
+	bob, _ := NewRandomAccount()
+	var err error
+	req := ObtRequestContent{
+		PayeePublicAddress: "0x1234",
+		Amount:             "1",
+		ChainCode:          "eth",
+		TokenCode:          " eth",
+	}
+	if _, err = req.Encrypt(alice, bob.PubKey); err == nil {
+		t.Error("expected lower-case codes to be rejected")
+	}
+	req.Normalize()
+	if req.ChainCode != "ETH" || req.TokenCode != "ETH" {
+		t.Errorf("codes were not normalized: %q %q", req.ChainCode, req.TokenCode)
+	}
+	if _, err = req.Encrypt(alice, bob.PubKey); err != nil {
+		t.Error(err)
+	}
+
+	rec := ObtRecordContent{
+		PayerPublicAddress: "0x1234",
+		PayeePublicAddress: "0x5678",
+		Amount:             "1",
+		ChainCode:          "eth",
+		TokenCode:          "",
+		ObtId:              "0xabc",
+	}
+	rec.Normalize()
+	if _, err = rec.Encrypt(alice, bob.PubKey); err == nil {
+		t.Error("expected empty token code to be rejected")
+	}
+	rec.TokenCode = "ELEVENCHARS"
+	if _, err = rec.Encrypt(alice, bob.PubKey); err == nil {
+		t.Error("expected over-long token code to be rejected")
+	}
+	rec.TokenCode = "ETH"
+	if _, err = rec.Encrypt(alice, bob.PubKey); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecryptContentAuto(t *testing.T) {
+	alice, _ := NewRandomAccount()
+	bob, _ := NewRandomAccount()
+
+	reqContent, err := ObtRequestContent{
+		PayeePublicAddress: alice.PubKey,
+		Amount:             "1.5",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Memo:               "lunch",
+		Hash:               "abc",
+		OfflineUrl:         "https://example.com/memo",
+	}.Encrypt(alice, bob.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, obtType, err := DecryptContentAuto(bob, alice.PubKey, reqContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obtType != ObtRequestType || result.Type != ObtRequestType || result.Request == nil {
+		t.Fatal("expected a request")
+	}
+	if result.Request.Amount != "1.5" || result.Request.OfflineUrl != "https://example.com/memo" {
+		t.Errorf("request did not decode correctly: %+v", result.Request)
+	}
+
+	recContent, err := ObtRecordContent{
+		PayerPublicAddress: bob.PubKey,
+		PayeePublicAddress: alice.PubKey,
+		Amount:             "1.5",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Status:             "sent_to_blockchain",
+		ObtId:              "0xabc",
+	}.Encrypt(bob, alice.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, obtType, err = DecryptContentAuto(alice, bob.PubKey, recContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obtType != ObtResponseType || result.Record == nil {
+		t.Fatal("expected a record")
+	}
+	if result.Record.ObtId != "0xabc" || result.Record.Status != "sent_to_blockchain" {
+		t.Errorf("record did not decode correctly: %+v", result.Record)
+	}
+
+	garbage, err := EciesEncrypt(alice, bob.PubKey, []byte{0xff}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = DecryptContentAuto(bob, alice.PubKey, garbage); err == nil {
+		t.Error("expected an error for content that is neither shape")
+	}
+}
+
+func TestNewRecordSendContent(t *testing.T) {
+	payer, _ := NewRandomAccount()
+	payee, _ := NewRandomAccount()
+	content := ObtRecordContent{
+		PayerPublicAddress: payer.PubKey,
+		PayeePublicAddress: payee.PubKey,
+		Amount:             "1",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Status:             "sent_to_blockchain",
+		ObtId:              "0xabc",
+	}
+	act, err := NewRecordSendContent(payer.Actor, 42, "payer@fiotestnet", "payee@fiotestnet", content, payer, payee.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Account != "fio.reqobt" || act.Name != "recordobt" {
+		t.Errorf("wrong contract or action: %s::%s", act.Account, act.Name)
+	}
+	data := act.Data.(RecordSend)
+	if data.FioRequestId != "42" || data.PayerFioAddress != "payer@fiotestnet" || data.PayeeFioAddress != "payee@fiotestnet" {
+		t.Errorf("unexpected action data: %+v", data)
+	}
+	decrypted, err := DecryptContent(payee, payer.PubKey, data.Content, ObtResponseType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Record.ObtId != "0xabc" {
+		t.Error("content did not decrypt to the record")
+	}
+
+	if _, err = NewRecordSendContent(payer.Actor, 42, "payer@fiotestnet", "payee@fiotestnet", content, nil, payee.PubKey); err == nil {
+		t.Error("expected an error without an account")
+	}
+	content.ChainCode = "F-IO"
+	if _, err = NewRecordSendContent(payer.Actor, 42, "payer@fiotestnet", "payee@fiotestnet", content, payer, payee.PubKey); err == nil {
+		t.Error("expected encryption errors to be returned")
+	}
+}
+
+func TestNewFundsReqContent(t *testing.T) {
+	payee, _ := NewRandomAccount()
+	var pending []RequestStatus
+	var payerPub string
+	payer, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/chain/push_transaction":
+			// keep the request so that it is returned as pending for the payer
+			packed := eos.PackedTransaction{}
+			body, _ := ioutil.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &packed)
+			signed, e := packed.Unpack()
+			if e != nil || len(signed.Actions) != 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fundsReq := FundsReq{}
+			if e = eos.UnmarshalBinary(signed.Actions[0].HexData, &fundsReq); e != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			pending = append(pending, RequestStatus{
+				FioRequestId:      uint64(len(pending) + 1),
+				PayerFioAddress:   fundsReq.PayerFioAddress,
+				PayeeFioAddress:   fundsReq.PayeeFioAddress,
+				PayerFioPublicKey: payerPub,
+				PayeeFioPublicKey: payee.PubKey,
+				Content:           fundsReq.Content,
+			})
+			_, _ = w.Write([]byte(`{"transaction_id":"00","processed":{"block_num":3}}`))
+		case "/v1/chain/get_pending_fio_requests":
+			_ = json.NewEncoder(w).Encode(PendingFioRequestsResponse{Requests: pending})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	payerPub = payer.PubKey
+
+	req := ObtRequestContent{
+		PayeePublicAddress: payee.PubKey,
+		Amount:             "2.5",
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Memo:               "round trip",
+	}
+	act, err := NewFundsReqContent(payee.Actor, "payer@fiotestnet", "payee@fiotestnet", req, payee, payer.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Name != "newfundsreq" || act.Data.(FundsReq).PayerFioAddress != "payer@fiotestnet" {
+		t.Errorf("unexpected action: %+v", act.Data)
+	}
+	// the payee signs, but the mock api was opened with the payer's key
+	if _, err = api.SignPushActionsWithSigner(NewKeyBagSigner(payee.KeyBag), act); err != nil {
+		t.Fatal(err)
+	}
+	reqs, err := api.GetDecryptedPendingRequests(payer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 1 || reqs[0].Err != nil {
+		t.Fatalf("expected one decrypted request, got %+v", reqs)
+	}
+	if reqs[0].Content.Amount != "2.5" || reqs[0].Content.Memo != "round trip" || reqs[0].PayeeFioAddress != "payee@fiotestnet" {
+		t.Errorf("request did not round trip: %+v", reqs[0].Content)
+	}
+
+	bad := []ObtRequestContent{req, req, req, req}
+	bad[0].PayeePublicAddress = ""
+	bad[1].Amount = "0"
+	bad[2].Amount = "two"
+	bad[3].TokenCode = "F-IO"
+	for i := range bad {
+		if _, err = NewFundsReqContent(payee.Actor, "payer@fiotestnet", "payee@fiotestnet", bad[i], payee, payer.PubKey); err == nil {
+			t.Errorf("expected invalid content %d to be rejected", i)
+		}
+	}
+	lower := req
+	lower.ChainCode, lower.TokenCode = "fio", " fio"
+	if _, err = NewFundsReqContent(payee.Actor, "payer@fiotestnet", "payee@fiotestnet", lower, payee, payer.PubKey); err != nil {
+		t.Errorf("lower-case codes should be normalized: %v", err)
+	}
+	if _, err = NewFundsReqContent(payee.Actor, "payer", "payee@fiotestnet", req, payee, payer.PubKey); err == nil {
+		t.Error("expected an invalid payer address to be rejected")
+	}
+}
+
+func TestEciesEncryptStream(t *testing.T) {
+	alice, err := NewRandomAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := NewRandomAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, 15, 16, 17, eciesStreamChunk - 1, eciesStreamChunk, 3*eciesStreamChunk + 7} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		// short reads should not change the output
+		encrypted := &bytes.Buffer{}
+		if err = EciesEncryptStream(alice, bob.PubKey, &chunkReader{r: bytes.NewReader(plain), n: 1000}, encrypted); err != nil {
+			t.Fatal(size, err)
+		}
+		if base64.StdEncoding.EncodedLen(encrypted.Len()) != EciesEncryptedLen(size) {
+			t.Errorf("%d: unexpected message length %d", size, encrypted.Len())
+		}
+
+		// compatible with EciesDecrypt
+		decrypted, err := EciesDecrypt(bob, alice.PubKey, base64.StdEncoding.EncodeToString(encrypted.Bytes()))
+		if err != nil {
+			t.Fatal(size, err)
+		}
+		if !bytes.Equal(plain, decrypted) {
+			t.Errorf("%d: EciesDecrypt did not match the plaintext", size)
+		}
+
+		streamed := &bytes.Buffer{}
+		if err = EciesDecryptStream(bob, alice.PubKey, &chunkReader{r: bytes.NewReader(encrypted.Bytes()), n: 333}, streamed); err != nil {
+			t.Fatal(size, err)
+		}
+		if !bytes.Equal(plain, streamed.Bytes()) {
+			t.Errorf("%d: EciesDecryptStream did not match the plaintext", size)
+		}
+	}
+
+	// and EciesEncrypt output can be streamed
+	content, err := EciesEncrypt(alice, bob.PubKey, []byte("hello bob"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(content)
+	streamed := &bytes.Buffer{}
+	if err = EciesDecryptStream(bob, alice.PubKey, bytes.NewReader(raw), streamed); err != nil || streamed.String() != "hello bob" {
+		t.Errorf("could not stream decrypt EciesEncrypt output: %q %v", streamed.String(), err)
+	}
+
+	raw[eciesIvLen] ^= 1
+	if err = EciesDecryptStream(bob, alice.PubKey, bytes.NewReader(raw), ioutil.Discard); err != ErrEciesHmac {
+		t.Errorf("expected ErrEciesHmac for tampered message, got %v", err)
+	}
+	if err = EciesDecryptStream(bob, alice.PubKey, bytes.NewReader(raw[:40]), ioutil.Discard); err == nil {
+		t.Error("expected error for short message")
+	}
+}
+
+// chunkReader limits each read to n bytes
+type chunkReader struct {
+	r *bytes.Reader
+	n int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+	return c.r.Read(p)
+}
+
+func TestZeroSecret(t *testing.T) {
+	alice, err := NewRandomAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := NewRandomAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the encrypt and decrypt functions derive their keys with eciesKeys, capture the secret it is handed
+	secrets := make([][]byte, 0)
+	derive := func(private *Account, public string) ([]byte, *[64]byte, error) {
+		secret, hash, err := EciesSecret(private, public)
+		if err == nil {
+			secrets = append(secrets, secret, hash[:])
+		}
+		return secret, hash, err
+	}
+	keys, err := eciesKeysFrom(derive, alice, bob.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) == 0 {
+		t.Fatal("secret was not derived")
+	}
+	for _, b := range secrets {
+		if len(b) == 0 || !bytes.Equal(b, make([]byte, len(b))) {
+			t.Error("secret was not zeroed")
+		}
+	}
+	expect, err := eciesKeys(bob, alice.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 64 || !bytes.Equal(keys, expect) {
+		t.Error("both sides should derive the same keys")
+	}
+
+	b := []byte{1, 2, 3}
+	ZeroSecret(b)
+	ZeroSecret(nil)
+	if !bytes.Equal(b, []byte{0, 0, 0}) {
+		t.Error("ZeroSecret did not zero the slice")
+	}
+}
@@ -0,0 +1,165 @@
+package fio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fioprotocol/fio-go/eos"
+	"github.com/fioprotocol/fio-go/eos/ecc"
+)
+
+// Signer provides transaction signatures without requiring access to the private keys, allowing an HSM or remote
+// signing service to be used in place of a KeyBag.
+type Signer interface {
+	// PublicKeys lists the keys the signer is able to sign with.
+	PublicKeys() ([]ecc.PublicKey, error)
+	// Sign adds signatures to the transaction for the given chain.
+	Sign(tx *eos.SignedTransaction, chainID eos.Checksum256) (*eos.SignedTransaction, error)
+}
+
+// KeyBagSigner is the default Signer, it signs using every key in an eos.KeyBag. If Keys is set, only those keys
+// are used, which is helpful when a KeyBag holds both rotated and current keys.
+type KeyBagSigner struct {
+	KeyBag *eos.KeyBag
+	Keys   []ecc.PublicKey
+}
+
+// NewKeyBagSigner returns a Signer backed by a KeyBag, such as Account.KeyBag
+func NewKeyBagSigner(keyBag *eos.KeyBag) *KeyBagSigner {
+	return &KeyBagSigner{KeyBag: keyBag}
+}
+
+// NewKeyBagSignerForKey returns a Signer that only signs with the given public key, which must be in the KeyBag
+func NewKeyBagSignerForKey(keyBag *eos.KeyBag, pubKey string) (*KeyBagSigner, error) {
+	pub, err := ecc.NewPublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	available, err := keyBag.AvailableKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range available {
+		if k.String() == pub.String() {
+			return &KeyBagSigner{KeyBag: keyBag, Keys: []ecc.PublicKey{pub}}, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s is not in the KeyBag", pubKey)
+}
+
+// NewKeyBagSignerForIndex returns a Signer that only signs with the key at the index in the KeyBag
+func NewKeyBagSignerForIndex(keyBag *eos.KeyBag, index int) (*KeyBagSigner, error) {
+	if index < 0 || index >= len(keyBag.Keys) {
+		return nil, fmt.Errorf("key index %d out of range, KeyBag has %d keys", index, len(keyBag.Keys))
+	}
+	return &KeyBagSigner{KeyBag: keyBag, Keys: []ecc.PublicKey{keyBag.Keys[index].PublicKey()}}, nil
+}
+
+// PublicKeys returns the selected keys, or all of the public keys for the KeyBag if none were selected
+func (kbs *KeyBagSigner) PublicKeys() ([]ecc.PublicKey, error) {
+	if len(kbs.Keys) > 0 {
+		return kbs.Keys, nil
+	}
+	return kbs.KeyBag.AvailableKeys()
+}
+
+// Sign signs the transaction with the keys returned by PublicKeys
+func (kbs *KeyBagSigner) Sign(tx *eos.SignedTransaction, chainID eos.Checksum256) (*eos.SignedTransaction, error) {
+	keys, err := kbs.PublicKeys()
+	if err != nil {
+		return nil, err
+	}
+	return kbs.KeyBag.Sign(tx, chainID, keys...)
+}
+
+// SignPushActionsWithSigner is the same as SignPushActions, but signs using the provided Signer instead of the
+// keys the API was created with.
+func (api *API) SignPushActionsWithSigner(signer Signer, a ...*Action) (out *eos.PushTransactionFullResp, err error) {
+	if signer == nil {
+		return nil, fmt.Errorf("no Signer provided")
+	}
+	a = api.applyTpid(a)
+	opts := &TxOptions{}
+	if err = opts.FillFromChain(api.API); err != nil {
+		return nil, err
+	}
+	tx := NewTransaction(a, opts)
+	for i := range tx.Actions {
+		if err = eos.CheckFioFeeRange(tx.Actions[i]); err != nil {
+			return nil, err
+		}
+	}
+	signed, err := signer.Sign(eos.NewSignedTransaction(tx), opts.ChainID)
+	if err != nil {
+		return nil, fmt.Errorf("signing: %w", err)
+	}
+	packed, err := signed.Pack(opts.Compress)
+	if err != nil {
+		return nil, err
+	}
+	return api.PushTransaction(packed)
+}
+
+// SignPushActionsWithKey is the same as SignPushActions, but only signs with the specified public key from the KeyBag
+// the API was created with. SignPushActions selects keys based on the required authorization, this is for cases
+// where that is ambiguous, such as a KeyBag holding keys that have been rotated.
+func (api *API) SignPushActionsWithKey(pubKey string, a ...*Action) (out *eos.PushTransactionFullResp, err error) {
+	keyBag, ok := api.Signer.(*eos.KeyBag)
+	if !ok {
+		return nil, fmt.Errorf("api signer is not a KeyBag")
+	}
+	signer, err := NewKeyBagSignerForKey(keyBag, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return api.SignPushActionsWithSigner(signer, a...)
+}
+
+// SignTransactionOffline signs a transaction with the account's keys without contacting a node, for air-gapped or
+// cold-storage signing. The chain ID and TAPoS reference block are supplied by the caller, build the transaction
+// with NewTransaction using TxOptions that has HeadBlockID set.
+func (a *Account) SignTransactionOffline(tx *eos.Transaction, chainID eos.Checksum256) (*eos.SignedTransaction, error) {
+	if a == nil || a.KeyBag == nil || len(a.KeyBag.Keys) == 0 {
+		return nil, errors.New("account does not have a private key")
+	}
+	if tx == nil {
+		return nil, errors.New("transaction is nil")
+	}
+	if len(chainID) != 32 {
+		return nil, fmt.Errorf("chain ID should be 32 bytes, got %d", len(chainID))
+	}
+	if tx.RefBlockNum == 0 && tx.RefBlockPrefix == 0 {
+		return nil, errors.New("transaction does not reference a block, set TxOptions.HeadBlockID")
+	}
+	return NewKeyBagSigner(a.KeyBag).Sign(eos.NewSignedTransaction(tx), chainID)
+}
+
+// PackTransaction packs a signed transaction so it can be sent using API.PushTransaction
+func PackTransaction(stx *eos.SignedTransaction, compression eos.CompressionType) (*eos.PackedTransaction, error) {
+	if stx == nil || stx.Transaction == nil {
+		return nil, errors.New("transaction is nil")
+	}
+	if len(stx.Signatures) == 0 {
+		return nil, errors.New("transaction is not signed")
+	}
+	return stx.Pack(compression)
+}
+
+// PackedTransactionJSON returns the uncompressed packed transaction as the JSON body expected by push_transaction,
+// so that a transaction signed offline can be handed to another process or node.
+func PackedTransactionJSON(stx *eos.SignedTransaction) ([]byte, error) {
+	packed, err := PackTransaction(stx, CompressionNone)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(packed)
+}
+
+// PushPackedTransactionJSON submits a transaction created by PackedTransactionJSON
+func (api *API) PushPackedTransactionJSON(packedJson []byte) (*eos.PushTransactionFullResp, error) {
+	packed := &eos.PackedTransaction{}
+	if err := json.Unmarshal(packedJson, packed); err != nil {
+		return nil, err
+	}
+	return api.PushTransaction(packed)
+}
@@ -0,0 +1,251 @@
+package fio
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/fioprotocol/fio-go/eos"
+	"github.com/fioprotocol/fio-go/eos/ecc"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+type recordingSigner struct {
+	signer  Signer
+	signed  []*eos.SignedTransaction
+	chainID eos.Checksum256
+	err     error
+}
+
+func (rs *recordingSigner) PublicKeys() ([]ecc.PublicKey, error) {
+	return rs.signer.PublicKeys()
+}
+
+func (rs *recordingSigner) Sign(tx *eos.SignedTransaction, chainID eos.Checksum256) (*eos.SignedTransaction, error) {
+	rs.signed = append(rs.signed, tx)
+	rs.chainID = chainID
+	if rs.err != nil {
+		return nil, rs.err
+	}
+	return rs.signer.Sign(tx, chainID)
+}
+
+func TestAPI_SignPushActionsWithSigner(t *testing.T) {
+	var pushed eos.PackedTransaction
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/push_transaction" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &pushed)
+		_, _ = w.Write([]byte(`{"transaction_id":"00","processed":{"block_num":3}}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// a different account than the api was created with
+	other, _ := NewRandomAccount()
+	signer := &recordingSigner{signer: NewKeyBagSigner(other.KeyBag)}
+	_, err = api.SignPushActionsWithSigner(signer, NewTransferTokensPubKey(other.Actor, other.PubKey, Tokens(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signer.signed) != 1 || signer.signed[0].Actions[0].Name != "trnsfiopubky" {
+		t.Fatal("signer was not asked to sign the transfer")
+	}
+	if signer.chainID.String() != ChainIdTestnet {
+		t.Error("signer got the wrong chain id")
+	}
+	if len(pushed.Signatures) != 1 {
+		t.Error("pushed transaction was not signed")
+	}
+	keys, _ := signer.PublicKeys()
+	if len(keys) != 1 || keys[0].String() != other.KeyBag.Keys[0].PublicKey().String() {
+		t.Error("signer had wrong public key")
+	}
+
+	// errors from the signer, for example an HSM, are wrapped
+	errHsm := errors.New("hsm unavailable")
+	signer.err = errHsm
+	if _, err = api.SignPushActionsWithSigner(signer, NewTransferTokensPubKey(other.Actor, other.PubKey, Tokens(1))); !errors.Is(err, errHsm) {
+		t.Errorf("expected the signer's error to be wrapped, got %v", err)
+	}
+}
+
+func TestAPI_SignPushActionsWithKey(t *testing.T) {
+	var pushed eos.PackedTransaction
+	acc, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/push_transaction" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &pushed)
+		_, _ = w.Write([]byte(`{"transaction_id":"00","processed":{"block_num":3}}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// add a second key, the original remains the first in the bag
+	rotated, _ := NewRandomAccount()
+	if err = acc.KeyBag.Add(rotated.KeyBag.Keys[0].String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewKeyBagSignerForIndex(acc.KeyBag, 2); err == nil {
+		t.Error("expected error for out of range index")
+	}
+	bySecond, err := NewKeyBagSignerForIndex(acc.KeyBag, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := bySecond.PublicKeys()
+	if len(keys) != 1 || keys[0].String() != rotated.KeyBag.Keys[0].PublicKey().String() {
+		t.Error("index signer selected the wrong key")
+	}
+
+	_, err = api.SignPushActionsWithKey(rotated.PubKey, NewTransferTokensPubKey(acc.Actor, rotated.PubKey, Tokens(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pushed.Signatures) != 1 {
+		t.Fatalf("expected a single signature, got %d", len(pushed.Signatures))
+	}
+	signed, err := pushed.Unpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txdata, cfd, err := signed.PackedTransactionAndCFD()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID, _ := hex.DecodeString(ChainIdTestnet)
+	signer, err := pushed.Signatures[0].PublicKey(eos.SigDigest(chainID, txdata, cfd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.String() != rotated.KeyBag.Keys[0].PublicKey().String() {
+		t.Error("transaction was not signed by the selected key")
+	}
+
+	unknown, _ := NewRandomAccount()
+	if _, err = api.SignPushActionsWithKey(unknown.PubKey); err == nil {
+		t.Error("expected error signing with a key not in the KeyBag")
+	}
+}
+
+func TestAccount_SignTransactionOffline(t *testing.T) {
+	acc, err := NewAccountFromSeed([]byte("cold storage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID, _ := hex.DecodeString(ChainIdTestnet)
+	headBlock, _ := hex.DecodeString("0000138a2bd2e0f4a9b7e3e04ad9a0e9fa3bbd1c33b1a8c1b4a4e0c33af49eb3")
+	tx := NewTransaction(
+		[]*Action{NewTransferTokensPubKey(acc.Actor, "FIO5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82", Tokens(1))},
+		&TxOptions{TxOptions: eos.TxOptions{HeadBlockID: headBlock}},
+	)
+	if tx.RefBlockNum != 0x138a {
+		t.Fatalf("TAPoS was not filled, ref block num %d", tx.RefBlockNum)
+	}
+
+	signed, err := acc.SignTransactionOffline(tx, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := signed.SignedByKeys(chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].String() != acc.PubKey {
+		t.Errorf("signature did not verify for %s: %v", acc.PubKey, keys)
+	}
+
+	packed, err := PackTransaction(signed, CompressionNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packed.Signatures) != 1 || len(packed.PackedTransaction) == 0 {
+		t.Error("packed transaction is incomplete")
+	}
+
+	if _, err = acc.SignTransactionOffline(tx, chainID[:16]); err == nil {
+		t.Error("expected an error for a short chain id")
+	}
+	if _, err = acc.SignTransactionOffline(NewTransaction(nil, nil), chainID); err == nil {
+		t.Error("expected an error without a reference block")
+	}
+	if _, err = PackTransaction(eos.NewSignedTransaction(tx), CompressionNone); err == nil {
+		t.Error("expected an error packing an unsigned transaction")
+	}
+}
+
+func TestPackedTransactionJSON(t *testing.T) {
+	acc, _ := NewAccountFromSeed([]byte("cold storage"))
+	chainID, _ := hex.DecodeString(ChainIdTestnet)
+	headBlock, _ := hex.DecodeString("0000138a2bd2e0f4a9b7e3e04ad9a0e9fa3bbd1c33b1a8c1b4a4e0c33af49eb3")
+	tx := NewTransaction(
+		[]*Action{NewTransferTokensPubKey(acc.Actor, "FIO5oBUYbtGTxMS66pPkjC2p8pbA3zCtc8XD4dq9fMut867GRdh82", Tokens(1))},
+		&TxOptions{TxOptions: eos.TxOptions{HeadBlockID: headBlock}},
+	)
+	signed, err := acc.SignTransactionOffline(tx, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := PackedTransactionJSON(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]interface{})
+	if err = json.Unmarshal(payload, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"signatures", "compression", "packed_context_free_data", "packed_trx"} {
+		if _, ok := fields[f]; !ok {
+			t.Errorf("payload is missing %s: %s", f, payload)
+		}
+	}
+
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/push_transaction" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		packed := &eos.PackedTransaction{}
+		if e := json.NewDecoder(r.Body).Decode(packed); e != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		unpacked, e := packed.Unpack()
+		if e != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		keys, e := unpacked.SignedByKeys(chainID)
+		if e != nil || len(keys) != 1 || keys[0].String() != acc.PubKey {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":500,"message":"bad signature"}`))
+			return
+		}
+		id, _ := packed.ID()
+		_, _ = w.Write([]byte(`{"transaction_id":"` + hex.EncodeToString(id) + `"}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	resp, err := api.PushPackedTransactionJSON(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repacked, _ := PackTransaction(signed, CompressionNone)
+	expect, _ := repacked.ID()
+	if resp.TransactionID != hex.EncodeToString(expect) {
+		t.Errorf("unexpected transaction id %s", resp.TransactionID)
+	}
+}
@@ -0,0 +1,80 @@
+package fio
+
+import (
+	"errors"
+	"github.com/fioprotocol/fio-go/eos"
+)
+
+// StakeFio stakes tokens in return for staking rewards, the fee is paid by bundled transactions when a FIO
+// address is provided.
+type StakeFio struct {
+	FioAddress string          `json:"fio_address"`
+	Amount     uint64          `json:"amount"`
+	MaxFee     uint64          `json:"max_fee"`
+	Actor      eos.AccountName `json:"actor"`
+	Tpid       string          `json:"tpid"`
+}
+
+// NewStakeFio builds a stakefio action, amount is in SUFs. The fioAddress is optional.
+func NewStakeFio(actor eos.AccountName, fioAddress string, amount uint64) (*Action, error) {
+	if amount == 0 {
+		return nil, errors.New("amount must be greater than zero")
+	}
+	if fioAddress != "" {
+		if err := ValidateFioAddress(Address(fioAddress)); err != nil {
+			return nil, err
+		}
+	}
+	fee, err := LookupMaxFee(FeeStakeFio)
+	if err != nil {
+		return nil, err
+	}
+	return NewAction(
+		"fio.staking", "stakefio", actor,
+		StakeFio{
+			FioAddress: fioAddress,
+			Amount:     amount,
+			MaxFee:     Tokens(fee),
+			Actor:      actor,
+			Tpid:       CurrentTpid(),
+		},
+	), nil
+}
+
+// UnStakeFio returns staked tokens to the account
+type UnStakeFio struct {
+	FioAddress string          `json:"fio_address"`
+	Amount     uint64          `json:"amount"`
+	MaxFee     uint64          `json:"max_fee"`
+	Actor      eos.AccountName `json:"actor"`
+	Tpid       string          `json:"tpid"`
+}
+
+// NewUnStakeFio builds an unstakefio action, amount is in SUFs. The fioAddress is optional.
+//
+// Unstaked tokens, along with any rewards, are locked for a period (7 days on mainnet) before they can be spent. During
+// that time they are counted in GetFioBalanceResp.Balance but not Available, use GetFioBalanceResp.Locked to see them.
+func NewUnStakeFio(actor eos.AccountName, fioAddress string, amount uint64) (*Action, error) {
+	if amount == 0 {
+		return nil, errors.New("amount must be greater than zero")
+	}
+	if fioAddress != "" {
+		if err := ValidateFioAddress(Address(fioAddress)); err != nil {
+			return nil, err
+		}
+	}
+	fee, err := LookupMaxFee(FeeUnstakeFio)
+	if err != nil {
+		return nil, err
+	}
+	return NewAction(
+		"fio.staking", "unstakefio", actor,
+		UnStakeFio{
+			FioAddress: fioAddress,
+			Amount:     amount,
+			MaxFee:     Tokens(fee),
+			Actor:      actor,
+			Tpid:       CurrentTpid(),
+		},
+	), nil
+}
@@ -0,0 +1,63 @@
+package fio
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewStakeFio(t *testing.T) {
+	prev := CurrentTpid()
+	defer SetTpid(prev)
+	SetTpid("tpid@fiotestnet")
+
+	act, err := NewStakeFio("htjonrkf1lgs", "ada@dapixdev", Tokens(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Account != "fio.staking" || act.Name != "stakefio" {
+		t.Errorf("wrong contract or action: %s::%s", act.Account, act.Name)
+	}
+	d := act.Data.(StakeFio)
+	if d.Amount != 100_000_000_000 || d.FioAddress != "ada@dapixdev" || d.Tpid != "tpid@fiotestnet" || d.MaxFee != Tokens(GetMaxFee(FeeStakeFio)) {
+		t.Errorf("unexpected action data: %+v", d)
+	}
+	if _, err = NewStakeFio("htjonrkf1lgs", "", Tokens(1)); err != nil {
+		t.Error("fio address should be optional:", err)
+	}
+	if _, err = NewStakeFio("htjonrkf1lgs", "ada@dapixdev", 0); err == nil {
+		t.Error("expected an error for a zero amount")
+	}
+	if _, err = NewStakeFio("htjonrkf1lgs", "invalid", 1); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestNewUnStakeFio(t *testing.T) {
+	act, err := NewUnStakeFio("htjonrkf1lgs", "", Tokens(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Account != "fio.staking" || act.Name != "unstakefio" {
+		t.Errorf("wrong contract or action: %s::%s", act.Account, act.Name)
+	}
+	if d := act.Data.(UnStakeFio); d.Amount != Tokens(10) || d.MaxFee != Tokens(GetMaxFee(FeeUnstakeFio)) {
+		t.Errorf("unexpected action data: %+v", d)
+	}
+	if _, err = NewUnStakeFio("htjonrkf1lgs", "", 0); err == nil {
+		t.Error("expected an error for a zero amount")
+	}
+}
+
+func TestGetFioBalanceResp_Locked(t *testing.T) {
+	b := &GetFioBalanceResp{}
+	if err := json.Unmarshal([]byte(`{"balance":1000,"available":600,"staked":300}`), b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Staked != 300 || b.Locked() != 100 {
+		t.Errorf("expected 300 staked and 100 locked, got %d %d", b.Staked, b.Locked())
+	}
+	b = &GetFioBalanceResp{Balance: 10, Available: 10, Staked: 5}
+	if b.Locked() != 0 {
+		t.Error("locked should not underflow")
+	}
+}
@@ -1,18 +1,69 @@
 package fio
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
 	"github.com/shopspring/decimal"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 const FioSymbol = "ᵮ"
 
 // Tokens is a convenience function for converting from a float for human readability.
 // Example 1 FIO Token: Tokens(1.0) == uint64(1000000000)
+//
+// A float64 only has about 15 significant digits, so amounts above roughly 9 million FIO with SUF precision cannot
+// be represented exactly, use TokensFromString when exact amounts are required.
 func Tokens(tokens float64) uint64 {
 	return uint64(decimal.NewFromFloat(tokens).Mul(decimal.NewFromInt(1000000000)).IntPart())
 }
 
+// TokensFromString parses a decimal amount of FIO, such as "12345678.123456789", into SUFs without using floating
+// point. An error is returned for negative amounts, more than 9 decimal places, or an amount that overflows a uint64.
+func TokensFromString(s string) (uint64, error) {
+	d, err := decimal.NewFromString(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	if d.IsNegative() {
+		return 0, fmt.Errorf("amount %s is negative", s)
+	}
+	suf := d.Shift(9)
+	if !suf.Equal(suf.Truncate(0)) {
+		return 0, fmt.Errorf("amount %s has more than 9 decimal places", s)
+	}
+	i := suf.BigInt()
+	if !i.IsUint64() {
+		return 0, fmt.Errorf("amount %s is too large", s)
+	}
+	return i.Uint64(), nil
+}
+
+// FormatFio converts an amount in SUFs (the smallest unit, 1 FIO == 1,000,000,000 SUF) to a string suitable for
+// displaying to a user, for example FormatFio(1_500_000_000) == "1.5 FIO"
+func FormatFio(suf uint64) string {
+	return FromTokensDecimal(suf).String() + " FIO"
+}
+
+// FromTokens is the inverse of Tokens, converting an amount in SUFs to FIO. Very large amounts may not be exactly
+// representable as a float64, FromTokensDecimal should be used when that matters.
+func FromTokens(suf uint64) float64 {
+	f, _ := FromTokensDecimal(suf).Float64()
+	return f
+}
+
+// FromTokensDecimal converts an amount in SUFs to an exact decimal amount of FIO
+func FromTokensDecimal(suf uint64) decimal.Decimal {
+	return decimal.NewFromBigInt(new(big.Int).SetUint64(suf), -9)
+}
+
 // TransferTokensPubKey is used to send FIO tokens to a public key
 type TransferTokensPubKey struct {
 	PayeePublicKey string          `json:"payee_public_key"`
@@ -22,7 +73,9 @@ type TransferTokensPubKey struct {
 	Tpid           string          `json:"tpid"`
 }
 
-// NewTransferTokensPubKey builds an eos.Action for sending FIO tokens
+// NewTransferTokensPubKey builds an eos.Action for sending FIO tokens. The trnsfiopubky action does not have a memo,
+// to attach one record the transfer with NewTransferRecordContent and NewRecordObt (or NewRecordSendContent when
+// paying a request), which stores the memo encrypted so that only the payer and payee can read it.
 func NewTransferTokensPubKey(actor eos.AccountName, recipientPubKey string, amount uint64) *Action {
 	return NewAction(
 		"fio.token", "trnsfiopubky", actor,
@@ -36,6 +89,205 @@ func NewTransferTokensPubKey(actor eos.AccountName, recipientPubKey string, amou
 	)
 }
 
+// NewTransferRecordContent builds the OBT record for a completed FIO token transfer so that a memo can be attached,
+// txid is the id of the transaction with the transfer. If the memo would make the encrypted record larger than the
+// contract allows, ErrContentTooLarge is returned, use ObtRecordContent.SplitMemo to move a long memo off-chain.
+// Send the record with NewRecordObt since it is not a response to a request.
+func NewTransferRecordContent(payerPubKey string, payeePubKey string, amount uint64, txid string, memo string) (ObtRecordContent, error) {
+	if txid == "" {
+		return ObtRecordContent{}, errors.New("the transfer's transaction id is required")
+	}
+	rec := ObtRecordContent{
+		PayerPublicAddress: payerPubKey,
+		PayeePublicAddress: payeePubKey,
+		Amount:             FromTokensDecimal(amount).String(),
+		ChainCode:          "FIO",
+		TokenCode:          "FIO",
+		Status:             "sent_to_blockchain",
+		ObtId:              txid,
+		Memo:               memo,
+	}
+	bin, err := rec.EncodeABI()
+	if err != nil {
+		return ObtRecordContent{}, err
+	}
+	if err = checkContentLen(len(bin), ObtRecordContentMaxLen); err != nil {
+		return ObtRecordContent{}, err
+	}
+	return rec, nil
+}
+
+// ErrNotTransfer is returned by DecodeTransferAction for actions other than fio.token::trnsfiopubky
+var ErrNotTransfer = errors.New("action is not a fio.token::trnsfiopubky transfer")
+
+// DecodeTransferAction returns the TransferTokensPubKey for a trnsfiopubky action from a history trace, or
+// ErrNotTransfer for any other action. The binary hex_data is used if present since large amounts lose precision
+// when the JSON data is decoded.
+func DecodeTransferAction(trace eos.ActionTrace) (*TransferTokensPubKey, error) {
+	act := trace.Action
+	if act == nil || act.Account != "fio.token" || act.Name != "trnsfiopubky" {
+		return nil, ErrNotTransfer
+	}
+	switch d := act.Data.(type) {
+	case TransferTokensPubKey:
+		return &d, nil
+	case *TransferTokensPubKey:
+		return d, nil
+	}
+	transfer := &TransferTokensPubKey{}
+	if len(act.HexData) > 0 {
+		if err := eos.UnmarshalBinary(act.HexData, transfer); err != nil {
+			return nil, fmt.Errorf("decoding transfer: %v", err)
+		}
+		return transfer, nil
+	}
+	if act.Data == nil {
+		return nil, errors.New("transfer action has no data")
+	}
+	j, err := json.Marshal(act.Data)
+	if err != nil {
+		return nil, err
+	}
+	// amounts may be numbers or strings
+	raw := struct {
+		PayeePublicKey string          `json:"payee_public_key"`
+		Amount         json.RawMessage `json:"amount"`
+		MaxFee         json.RawMessage `json:"max_fee"`
+		Actor          eos.AccountName `json:"actor"`
+		Tpid           string          `json:"tpid"`
+	}{}
+	if err = json.Unmarshal(j, &raw); err != nil {
+		return nil, fmt.Errorf("decoding transfer: %v", err)
+	}
+	transfer.PayeePublicKey, transfer.Actor, transfer.Tpid = raw.PayeePublicKey, raw.Actor, raw.Tpid
+	if transfer.Amount, err = strconv.ParseUint(strings.Trim(string(raw.Amount), `"`), 10, 64); err != nil {
+		return nil, fmt.Errorf("decoding transfer amount: %v", err)
+	}
+	if transfer.MaxFee, err = strconv.ParseUint(strings.Trim(string(raw.MaxFee), `"`), 10, 64); err != nil {
+		return nil, fmt.Errorf("decoding transfer max_fee: %v", err)
+	}
+	return transfer, nil
+}
+
+// ErrTransferPolicy is returned when a transaction would move more tokens than allowed by SetMaxTransferPerTx
+var ErrTransferPolicy = errors.New("transfer exceeds the maximum amount allowed per transaction")
+
+// SetMaxTransferPerTx sets a limit (in SUFs) on the total amount of FIO tokens that can be sent using
+// TransferTokensPubKey actions in a single transaction, a value of zero removes the limit. Transactions exceeding
+// the limit are refused with an ErrTransferPolicy error. SplitTransferTokensPubKey can be used to break a large
+// transfer into several transactions.
+//
+// The limit is checked by every API method that sends a transaction: the SignPushActions variants, PushTransaction,
+// SignPushTransaction, SignPushActionsWithOpts, and PushPackedTransactionJSON. It is not checked by
+// PushTransactionRaw, PushEndpointRaw, or by methods called directly on the embedded eos.API.
+func (api *API) SetMaxTransferPerTx(suf uint64) {
+	api.policyMux.Lock()
+	api.maxTransferPerTx = suf
+	api.policyMux.Unlock()
+}
+
+// MaxTransferPerTx returns the current per-transaction transfer limit, zero means no limit.
+func (api *API) MaxTransferPerTx() uint64 {
+	api.policyMux.RLock()
+	defer api.policyMux.RUnlock()
+	return api.maxTransferPerTx
+}
+
+// checkTransferPolicy totals the token transfers in a set of actions and returns an error if over the limit.
+func (api *API) checkTransferPolicy(actions []*Action) error {
+	limit := api.MaxTransferPerTx()
+	if limit == 0 {
+		return nil
+	}
+	b := make([]*eos.Action, 0, len(actions))
+	for _, a := range actions {
+		if a != nil {
+			b = append(b, a.ToEos())
+		}
+	}
+	return checkTransferLimit(b, limit)
+}
+
+// checkTransferLimit totals the token transfers, which may be typed or already packed, against limit
+func checkTransferLimit(actions []*eos.Action, limit uint64) error {
+	var total uint64
+	for _, a := range actions {
+		if a == nil || a.Account != "fio.token" || a.Name != "trnsfiopubky" {
+			continue
+		}
+		switch t := a.Data.(type) {
+		case TransferTokensPubKey:
+			total += t.Amount
+		case *TransferTokensPubKey:
+			total += t.Amount
+		default:
+			transfer := TransferTokensPubKey{}
+			if a.Data != nil || len(a.HexData) == 0 || eos.UnmarshalBinary(a.HexData, &transfer) != nil {
+				return fmt.Errorf("%w: could not determine transfer amount", ErrTransferPolicy)
+			}
+			total += transfer.Amount
+		}
+	}
+	if total > limit {
+		return fmt.Errorf("%w: %s is more than the limit of %s", ErrTransferPolicy, FormatFio(total), FormatFio(limit))
+	}
+	return nil
+}
+
+// SplitTransferTokensPubKey breaks a transfer into several actions, each no larger than maxPerTx. Each action
+// should be sent in a separate transaction. Note that each transfer will incur a fee.
+func SplitTransferTokensPubKey(actor eos.AccountName, recipientPubKey string, amount uint64, maxPerTx uint64) ([]*Action, error) {
+	if maxPerTx == 0 {
+		return nil, errors.New("maximum per transaction must be greater than zero")
+	}
+	actions := make([]*Action, 0, amount/maxPerTx+1)
+	for amount > 0 {
+		next := amount
+		if next > maxPerTx {
+			next = maxPerTx
+		}
+		actions = append(actions, NewTransferTokensPubKey(actor, recipientPubKey, next))
+		amount -= next
+	}
+	return actions, nil
+}
+
+// NewBatchTransfer builds a TransferTokensPubKey action for each recipient in payouts (public key to amount in SUFs).
+// Actions are sorted by public key so the result is repeatable, recipients with a zero amount are skipped.
+func NewBatchTransfer(actor eos.AccountName, payouts map[string]uint64) []*Action {
+	recipients := make([]string, 0, len(payouts))
+	for pub, amount := range payouts {
+		if amount > 0 {
+			recipients = append(recipients, pub)
+		}
+	}
+	sort.Strings(recipients)
+	actions := make([]*Action, len(recipients))
+	for i, pub := range recipients {
+		actions[i] = NewTransferTokensPubKey(actor, pub, payouts[pub])
+	}
+	return actions
+}
+
+// NewBatchTransferChunked is the same as NewBatchTransfer, but the actions are grouped into slices of at most perTx
+// actions so that each group can be sent in its own transaction.
+func NewBatchTransferChunked(actor eos.AccountName, payouts map[string]uint64, perTx int) ([][]*Action, error) {
+	if perTx < 1 {
+		return nil, errors.New("actions per transaction must be greater than zero")
+	}
+	actions := NewBatchTransfer(actor, payouts)
+	chunks := make([][]*Action, 0, len(actions)/perTx+1)
+	for len(actions) > 0 {
+		n := perTx
+		if n > len(actions) {
+			n = len(actions)
+		}
+		chunks = append(chunks, actions[:n])
+		actions = actions[n:]
+	}
+	return chunks, nil
+}
+
 // Transfer is a privileged call, and not normally used for sending tokens, use TransferTokensPubKey instead
 type Transfer struct {
 	From     eos.AccountName `json:"from"`
@@ -66,21 +318,119 @@ func NewTransfer(actor eos.AccountName, recipient eos.AccountName, amount uint64
 
 // GetBalance gets an account's balance
 func (api *API) GetBalance(account eos.AccountName) (float64, error) {
-	a, err := api.GetCurrencyBalance(account, "FIO", eos.AccountName("fio.token"))
+	return api.GetBalanceCtx(context.Background(), account)
+}
+
+// GetBalanceCtx is the same as GetBalance, but the request is cancelled when ctx is done
+func (api *API) GetBalanceCtx(ctx context.Context, account eos.AccountName) (float64, error) {
+	a := make([]eos.Asset, 0)
+	err := api.callCtx(ctx, "chain", "get_currency_balance", eos.M{"account": account, "code": "fio.token", "symbol": "FIO"}, &a)
 	if err != nil {
 		return 0.0, err
 	}
 	if len(a) > 0 {
 		if a[0].Amount > 0 {
-			return float64(a[0].Amount) / 1000000000.0, nil
+			return FromTokens(uint64(a[0].Amount)), nil
 		}
 	}
 	return 0.0, nil
 }
 
+// GetFioBalances looks up the balances for many public keys concurrently using the number of workers specified.
+// If the context is cancelled, work stops promptly and the balances retrieved so far are returned along with the
+// context's error. Keys that could not be looked up are not included in the result, and the first error encountered
+// is returned after the remaining keys have been processed.
+func (api *API) GetFioBalances(ctx context.Context, pubKeys []string, workers int) (balances map[string]*GetFioBalanceResp, err error) {
+	if workers < 1 {
+		workers = 1
+	}
+	balances = make(map[string]*GetFioBalanceResp)
+	mux := sync.Mutex{}
+	jobs := make(chan string)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pubKey := range jobs {
+				bal := &GetFioBalanceResp{}
+				e := api.callCtx(ctx, "chain", "get_fio_balance", &getFioBalanceReq{FioPublicKey: pubKey}, bal)
+				mux.Lock()
+				switch {
+				case e == nil:
+					balances[pubKey] = bal
+				case err == nil && ctx.Err() == nil:
+					err = e
+				}
+				mux.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, pubKey := range pubKeys {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- pubKey:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return balances, ctx.Err()
+	}
+	return balances, err
+}
+
+// ErrAccountNotFound is returned when querying an account that does not exist
+var ErrAccountNotFound = errors.New("account does not exist")
+
+// AccountBalance is returned by GetAccountBalance, Balance is in SUFs
+type AccountBalance struct {
+	AccountExists bool   `json:"account_exists"`
+	Balance       uint64 `json:"balance"`
+}
+
+// GetAccountBalance is similar to GetBalance, but distinguishes between an account with no tokens and an account
+// that does not exist, in which case ErrAccountNotFound is returned.
+func (api *API) GetAccountBalance(account eos.AccountName) (*AccountBalance, error) {
+	a, err := api.GetCurrencyBalance(account, "FIO", eos.AccountName("fio.token"))
+	if err != nil {
+		return nil, err
+	}
+	if len(a) > 0 {
+		bal := &AccountBalance{AccountExists: true}
+		if a[0].Amount > 0 {
+			bal.Balance = uint64(a[0].Amount)
+		}
+		return bal, nil
+	}
+	// an empty result is returned for both missing accounts and accounts without tokens
+	exists := json.RawMessage{}
+	err = api.call("chain", "get_account", map[string]string{"account_name": string(account)}, &exists)
+	if err == eos.ErrNotFound {
+		return nil, ErrAccountNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &AccountBalance{AccountExists: true}, nil
+}
+
 type GetFioBalanceResp struct {
 	Balance   uint64 `json:"balance"`
 	Available uint64 `json:"available"`
+	Staked    uint64 `json:"staked"`
+}
+
+// Locked is the part of the balance that is neither available nor staked, this includes genesis and grant locks as
+// well as tokens that were recently unstaked.
+func (b *GetFioBalanceResp) Locked() uint64 {
+	if b.Available+b.Staked > b.Balance {
+		return 0
+	}
+	return b.Balance - b.Available - b.Staked
 }
 
 type getFioBalanceReq struct {
@@ -90,6 +440,11 @@ type getFioBalanceReq struct {
 // GetFioBalance is the preferred way to get an account's balance, it will include the number of available
 // tokens in the case that an account holds locked/staked tokens.
 func (api *API) GetFioBalance(pubkey string) (fiobalance *GetFioBalanceResp, err error) {
-	err = api.call("chain", "get_fio_balance", &getFioBalanceReq{FioPublicKey: pubkey}, &fiobalance)
+	return api.GetFioBalanceCtx(context.Background(), pubkey)
+}
+
+// GetFioBalanceCtx is the same as GetFioBalance, but the request is cancelled when ctx is done
+func (api *API) GetFioBalanceCtx(ctx context.Context, pubkey string) (fiobalance *GetFioBalanceResp, err error) {
+	err = api.callCtx(ctx, "chain", "get_fio_balance", &getFioBalanceReq{FioPublicKey: pubkey}, &fiobalance)
 	return fiobalance, err
 }
@@ -1,6 +1,21 @@
 package fio
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fioprotocol/fio-go/eos"
+	"github.com/shopspring/decimal"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestFioToken(t *testing.T) {
 	account, api, opts, err := newApi()
@@ -42,3 +57,382 @@ func TestFioToken(t *testing.T) {
 		t.Error("balance was wrong")
 	}
 }
+
+func TestFormatFio(t *testing.T) {
+	for suf, expect := range map[uint64]string{
+		0:             "0 FIO",
+		1:             "0.000000001 FIO",
+		1_500_000_000: "1.5 FIO",
+		Tokens(800.0): "800 FIO",
+	} {
+		if got := FormatFio(suf); got != expect {
+			t.Errorf("FormatFio(%d) got %q, expected %q", suf, got, expect)
+		}
+	}
+}
+
+func TestFromTokens(t *testing.T) {
+	if FromTokens(Tokens(1.5)) != 1.5 || FromTokens(0) != 0 || FromTokens(1) != 0.000000001 {
+		t.Error("FromTokens is not the inverse of Tokens")
+	}
+	if got := FromTokensDecimal(math.MaxUint64).String(); got != "18446744073.709551615" {
+		t.Errorf("max uint64 was not exact: %s", got)
+	}
+	if FromTokens(math.MaxUint64) != 18446744073.709551615 {
+		t.Error("max uint64 float conversion is wrong")
+	}
+	if !FromTokensDecimal(1).Equal(decimal.New(1, -9)) {
+		t.Error("smallest unit was not exact")
+	}
+}
+
+func TestTokensFromString(t *testing.T) {
+	for in, expect := range map[string]uint64{
+		"0":                       0,
+		"1":                       1_000_000_000,
+		"0.000000001":             1,
+		"12345678.123456789":      12345678123456789,
+		" 800.5 ":                 800_500_000_000,
+		"18446744073.709551615":   math.MaxUint64,
+		"1.100000000000000000000": 1_100_000_000,
+	} {
+		got, err := TokensFromString(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if got != expect {
+			t.Errorf("%q: got %d, expected %d", in, got, expect)
+		}
+	}
+	for _, bad := range []string{"", "abc", "-1", "0.0000000001", "18446744073.709551616"} {
+		if _, err := TokensFromString(bad); err == nil {
+			t.Errorf("%q should not parse", bad)
+		}
+	}
+}
+
+func TestAPI_SetMaxTransferPerTx(t *testing.T) {
+	// no server is listening, the policy must be checked before attempting to connect
+	api := &API{API: eos.New("http://127.0.0.1:1")}
+	api.SetMaxTransferPerTx(Tokens(10))
+	recipient, _ := NewRandomAccount()
+
+	_, err := api.SignPushActions(NewTransferTokensPubKey("aftyershcu22", recipient.PubKey, Tokens(10.5)))
+	if !errors.Is(err, ErrTransferPolicy) {
+		t.Error("transfer over the limit was not refused:", err)
+	}
+	// two transfers in one transaction are totaled
+	_, err = api.SignPushActions(
+		NewTransferTokensPubKey("aftyershcu22", recipient.PubKey, Tokens(6)),
+		NewTransferTokensPubKey("aftyershcu22", recipient.PubKey, Tokens(6)),
+	)
+	if !errors.Is(err, ErrTransferPolicy) {
+		t.Error("multiple transfers over the limit were not refused:", err)
+	}
+	// under the limit passes the policy, but fails to connect
+	_, err = api.SignPushActions(NewTransferTokensPubKey("aftyershcu22", recipient.PubKey, Tokens(10)))
+	if err == nil || errors.Is(err, ErrTransferPolicy) {
+		t.Error("transfer at the limit should not be refused by policy:", err)
+	}
+
+	split, err := SplitTransferTokensPubKey("aftyershcu22", recipient.PubKey, Tokens(25), Tokens(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(split) != 3 || split[2].Data.(TransferTokensPubKey).Amount != Tokens(5) {
+		t.Error("transfer was not split correctly")
+	}
+}
+
+func TestAPI_SetMaxTransferPerTx_allPaths(t *testing.T) {
+	var pushed int32
+	acc, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/push_transaction" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		atomic.AddInt32(&pushed, 1)
+		_, _ = w.Write([]byte(`{"transaction_id":"00","processed":{"block_num":3}}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	api.SetMaxTransferPerTx(Tokens(10))
+	over := NewTransferTokensPubKey(acc.Actor, acc.PubKey, Tokens(11))
+
+	if _, err = api.SignPushActionsWithOpts([]*eos.Action{over.ToEos()}, nil); !errors.Is(err, ErrTransferPolicy) {
+		t.Error("SignPushActionsWithOpts did not check the limit:", err)
+	}
+
+	txOpts := &TxOptions{}
+	if err = txOpts.FillFromChain(api.API); err != nil {
+		t.Fatal(err)
+	}
+	tx := NewTransaction([]*Action{over}, txOpts)
+	tx.RefBlockNum = 2 // the mock's block ids don't produce a reference
+	signed, err := acc.SignTransactionOffline(tx, txOpts.ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := PackTransaction(signed, CompressionZlib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = api.PushTransaction(packed); !errors.Is(err, ErrTransferPolicy) {
+		t.Error("PushTransaction did not check the limit:", err)
+	}
+	j, err := PackedTransactionJSON(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = api.PushPackedTransactionJSON(j); !errors.Is(err, ErrTransferPolicy) {
+		t.Error("PushPackedTransactionJSON did not check the limit:", err)
+	}
+	if atomic.LoadInt32(&pushed) != 0 {
+		t.Errorf("transfers over the limit were pushed %d times", pushed)
+	}
+
+	// packed transfers under the limit are still sent
+	if _, err = api.SignPushActionsWithOpts([]*eos.Action{NewTransferTokensPubKey(acc.Actor, acc.PubKey, Tokens(10)).ToEos()}, nil); err != nil {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(&pushed) != 1 {
+		t.Error("transfer under the limit was not pushed")
+	}
+}
+
+func TestAPI_GetAccountBalance(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/v1/chain/get_currency_balance" && strings.Contains(string(body), "hasbalance11"):
+			_, _ = w.Write([]byte(`["12.500000000 FIO"]`))
+		case r.URL.Path == "/v1/chain/get_currency_balance":
+			_, _ = w.Write([]byte(`[]`))
+		case r.URL.Path == "/v1/chain/get_account" && strings.Contains(string(body), "emptyaccount"):
+			_, _ = w.Write([]byte(`{"account_name":"emptyaccount"}`))
+		case r.URL.Path == "/v1/chain/get_account":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"code":500,"message":"Internal Service Error","error":{"code":0,"name":"exception","what":"unspecified","details":[{"message":"unknown key (boost::tuples::tuple<bool, eosio::chain::name, boost::tuples::null_type>): (0 doesnotexist)","file":"","line_number":0,"method":""}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	bal, err := api.GetAccountBalance("hasbalance11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bal.AccountExists || bal.Balance != Tokens(12.5) {
+		t.Errorf("unexpected balance: %+v", bal)
+	}
+
+	bal, err = api.GetAccountBalance("emptyaccount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bal.AccountExists || bal.Balance != 0 {
+		t.Errorf("unexpected balance for empty account: %+v", bal)
+	}
+
+	_, err = api.GetAccountBalance("doesnotexist")
+	if err != ErrAccountNotFound {
+		t.Error("expected ErrAccountNotFound, got:", err)
+	}
+}
+
+func TestAPI_GetFioBalances_cancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests int32
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/get_fio_balance" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if atomic.AddInt32(&requests, 1) == 10 {
+			cancel()
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"balance":1000000000,"available":1000000000}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("FIO%d", i)
+	}
+	balances, err := api.GetFioBalances(ctx, keys, 4)
+	if err != context.Canceled {
+		t.Error("expected context.Canceled, got:", err)
+	}
+	if len(balances) == 0 || len(balances) >= len(keys) {
+		t.Errorf("expected partial results, got %d", len(balances))
+	}
+	for _, b := range balances {
+		if b.Balance != 1000000000 {
+			t.Error("partial result had wrong balance")
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n > 10+4 {
+		t.Errorf("work did not stop promptly, %d requests were made", n)
+	}
+
+	// ensure workers have exited
+	srv.Close()
+	api.HttpClient.CloseIdleConnections()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runtime.NumGoroutine() > before {
+		t.Errorf("goroutines leaked: %d before, %d after", before, runtime.NumGoroutine())
+	}
+}
+
+func TestDecodeTransferAction(t *testing.T) {
+	// history traces include both the json and the binary form of the data
+	trace := eos.ActionTrace{}
+	err := json.Unmarshal([]byte(`{"act":{"account":"fio.token","name":"trnsfiopubky","authorization":[{"actor":"htjonrkf1lgs","permission":"active"}],
+		"data":{"payee_public_key":"FIO6LKbc","amount":"9007199254740993","max_fee":2000000000,"actor":"htjonrkf1lgs","tpid":"tpid@fiotestnet"}}}`), &trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer, err := DecodeTransferAction(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Amount != 9007199254740993 || transfer.MaxFee != 2000000000 || transfer.PayeePublicKey != "FIO6LKbc" || transfer.Tpid != "tpid@fiotestnet" {
+		t.Errorf("unexpected transfer: %+v", transfer)
+	}
+
+	want := TransferTokensPubKey{PayeePublicKey: "FIO6LKbc", Amount: math.MaxUint64 - 1, MaxFee: 1, Actor: "htjonrkf1lgs"}
+	bin, err := eos.MarshalBinary(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace.Action.HexData = bin
+	if transfer, err = DecodeTransferAction(trace); err != nil {
+		t.Fatal(err)
+	}
+	if *transfer != want {
+		t.Errorf("hex_data should be preferred: %+v", transfer)
+	}
+
+	built := NewTransferTokensPubKey("htjonrkf1lgs", "FIO6LKbc", Tokens(1))
+	if transfer, err = DecodeTransferAction(eos.ActionTrace{Action: built.ToEos()}); err != nil || transfer.Amount != Tokens(1) {
+		t.Errorf("typed data was not returned: %v %+v", err, transfer)
+	}
+
+	vote := eos.ActionTrace{Action: &eos.Action{Account: "eosio", Name: "voteproducer"}}
+	if _, err = DecodeTransferAction(vote); err != ErrNotTransfer {
+		t.Errorf("expected ErrNotTransfer, got %v", err)
+	}
+	if _, err = DecodeTransferAction(eos.ActionTrace{}); err != ErrNotTransfer {
+		t.Errorf("expected ErrNotTransfer for an empty trace, got %v", err)
+	}
+}
+
+func TestNewTransferRecordContent(t *testing.T) {
+	payer, _ := NewRandomAccount()
+	payee, _ := NewRandomAccount()
+	const txid = "2a1c31dc3f8ba6f7df67a9c4f4c09b1ebcd7a0f9a1d9e0b5ec8a4b2c1d0e9f8a"
+	rec, err := NewTransferRecordContent(payer.PubKey, payee.PubKey, Tokens(1.5), txid, "for lunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Amount != "1.5" || rec.ObtId != txid || rec.Memo != "for lunch" || rec.ChainCode != "FIO" {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	content, err := rec.Encrypt(payer, payee.PubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	act := NewRecordObt(payer.Actor, "payer@fiotestnet", "payee@fiotestnet", content)
+	decrypted, err := DecryptContent(payee, payer.PubKey, act.Data.(RecordSend).Content, ObtResponseType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Record.Memo != "for lunch" {
+		t.Error("memo was not recorded")
+	}
+
+	// the limit is the size of the encrypted record, not the inline memo default
+	long := strings.Repeat("m", ObtMemoMaxLen+1)
+	if rec, err = NewTransferRecordContent(payer.PubKey, payee.PubKey, Tokens(1), txid, long); err != nil || rec.Memo != long {
+		t.Error("a memo that fits in the record should be accepted:", err)
+	}
+	if _, err = rec.Encrypt(payer, payee.PubKey); err != nil {
+		t.Error(err)
+	}
+	_, err = NewTransferRecordContent(payer.PubKey, payee.PubKey, Tokens(1), txid, strings.Repeat("m", ObtRecordContentMaxLen))
+	if !errors.Is(err, ErrContentTooLarge) {
+		t.Error("expected ErrContentTooLarge for an over-long memo, got", err)
+	}
+	if _, err = NewTransferRecordContent(payer.PubKey, payee.PubKey, Tokens(1), "", "memo"); err == nil {
+		t.Error("expected an error without a txid")
+	}
+}
+
+func TestNewBatchTransfer(t *testing.T) {
+	payouts := make(map[string]uint64)
+	var total uint64
+	for i := 0; i < 23; i++ {
+		acc, _ := NewRandomAccount()
+		payouts[acc.PubKey] = Tokens(float64(i + 1))
+		total += Tokens(float64(i + 1))
+	}
+	payouts["FIO5zeroamount"] = 0
+
+	actions := NewBatchTransfer("htjonrkf1lgs", payouts)
+	if len(actions) != 23 {
+		t.Fatalf("expected 23 actions, got %d", len(actions))
+	}
+	var sum uint64
+	for i, act := range actions {
+		transfer := act.Data.(TransferTokensPubKey)
+		if transfer.Amount != payouts[transfer.PayeePublicKey] {
+			t.Errorf("wrong amount for %s", transfer.PayeePublicKey)
+		}
+		if i > 0 && actions[i-1].Data.(TransferTokensPubKey).PayeePublicKey >= transfer.PayeePublicKey {
+			t.Error("actions are not sorted by recipient")
+		}
+		sum += transfer.Amount
+	}
+	if sum != total {
+		t.Errorf("expected a total of %d, got %d", total, sum)
+	}
+
+	chunks, err := NewBatchTransferChunked("htjonrkf1lgs", payouts, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 || len(chunks[0]) != 10 || len(chunks[1]) != 10 || len(chunks[2]) != 3 {
+		t.Errorf("unexpected chunks: %d", len(chunks))
+	}
+	sum = 0
+	for _, chunk := range chunks {
+		for _, act := range chunk {
+			sum += act.Data.(TransferTokensPubKey).Amount
+		}
+	}
+	if sum != total {
+		t.Errorf("chunked total %d does not match %d", sum, total)
+	}
+	if _, err = NewBatchTransferChunked("htjonrkf1lgs", payouts, 0); err == nil {
+		t.Error("expected an error for zero actions per transaction")
+	}
+	if chunks, _ = NewBatchTransferChunked("htjonrkf1lgs", nil, 5); len(chunks) != 0 {
+		t.Error("expected no chunks for no payouts")
+	}
+}
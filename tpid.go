@@ -1,7 +1,10 @@
 package fio
 
 import (
+	"errors"
+	"fmt"
 	"github.com/fioprotocol/fio-go/eos"
+	"reflect"
 	"sync"
 )
 
@@ -12,7 +15,8 @@ var tpidMux sync.RWMutex
 
 // SetTpid will set a package variable that will include the provided TPID in all of the calls that support it.
 // This only needs to be called once. By default it is empty, and is recommended for wallet providers or other
-// service providers to set at initialization via SetTpid to get rewards.
+// service providers to set at initialization via SetTpid to get rewards. An empty tpid means no rewards are
+// routed, see Action.WithNoTpid for deliberately sending an action without one.
 func SetTpid(walletAddress string) (ok bool) {
 	tpidMux.Lock()
 	defer tpidMux.Unlock()
@@ -30,6 +34,153 @@ func CurrentTpid() string {
 	return a
 }
 
+// WithNoTpid clears the tpid that the builder copied from the global, regardless of what SetTpid was called with.
+// An empty tpid means no reward routing. Actions without a tpid field are returned unchanged.
+func (act *Action) WithNoTpid() *Action {
+	if act.setTpid("") {
+		act.tpidSet = true
+	}
+	return act
+}
+
+// WithTpid sets the tpid for this action only, taking precedence over the global set by SetTpid. This allows
+// rewards to be routed per transaction without changing global state. The tpid must be a valid FIO address, and an
+// error is returned if the action does not have a tpid field.
+func (act *Action) WithTpid(tpid string) (*Action, error) {
+	if !Address(tpid).Valid() {
+		return nil, fmt.Errorf("invalid tpid %q", tpid)
+	}
+	if !act.setTpid(tpid) {
+		return nil, errors.New("action does not have a tpid")
+	}
+	act.tpidSet = true
+	return act, nil
+}
+
+// SetTpid sets the tpid used for actions sent by this API, replacing the global set by the package level SetTpid.
+// This allows several API instances in one process to route rewards to different wallets. Builders do not have
+// access to the API, so they still copy the global, and it is replaced when signing. Actions that had their tpid
+// chosen with WithTpid or WithNoTpid are not changed. An empty walletAddress reverts to the global.
+//
+// The tpid is applied by the functions accepting an *Action: SignPushActions, SignPushActionsRetry,
+// SignPushActionsWithSigner, SignPushActionsWithKey, and NewSignedMsigPropose. Transactions that are already built or
+// signed, such as those sent with PushTransaction, SignPushActionsWithOpts, PushPackedTransactionJSON, or
+// PushEndpointRaw, are sent as they are.
+func (api *API) SetTpid(walletAddress string) (ok bool) {
+	if walletAddress != "" && !Address(walletAddress).Valid() {
+		return false
+	}
+	api.policyMux.Lock()
+	api.tpid = walletAddress
+	api.policyMux.Unlock()
+	return true
+}
+
+// SetValidatedTpid is the same as API.SetTpid, but first checks that the address is registered on chain, because
+// transactions with an unknown tpid are rejected. Use SetTpid when working offline.
+func (api *API) SetValidatedTpid(walletAddress string) error {
+	if err := ValidateFioAddress(Address(walletAddress)); err != nil {
+		return fmt.Errorf("invalid tpid %q: %v", walletAddress, err)
+	}
+	available, err := api.IsFioAddressAvailable(Address(walletAddress))
+	if err != nil {
+		return err
+	}
+	if available {
+		return fmt.Errorf("tpid %q is not a registered FIO address", walletAddress)
+	}
+	api.SetTpid(walletAddress)
+	return nil
+}
+
+// Tpid returns the tpid used by this API, falling back to the global if it has not been set
+func (api *API) Tpid() string {
+	api.policyMux.RLock()
+	tpid := api.tpid
+	api.policyMux.RUnlock()
+	if tpid == "" {
+		return CurrentTpid()
+	}
+	return tpid
+}
+
+// applyTpid returns the actions with the API's tpid, actions that need to be changed are copied so the caller's
+// actions are not modified.
+func (api *API) applyTpid(actions []*Action) []*Action {
+	api.policyMux.RLock()
+	tpid := api.tpid
+	api.policyMux.RUnlock()
+	if tpid == "" {
+		return actions
+	}
+	out := make([]*Action, len(actions))
+	for i, act := range actions {
+		out[i] = act
+		if act == nil || act.tpidSet {
+			continue
+		}
+		cp := act.copyData()
+		if cp.setTpid(tpid) {
+			out[i] = cp
+		}
+	}
+	return out
+}
+
+// copyData returns a copy of the action, when the data is a pointer to a struct the value it points to is copied
+// too, so that setting a field on the copy does not change the original.
+func (act *Action) copyData() *Action {
+	cp := *act
+	v := reflect.ValueOf(act.Data)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		data := reflect.New(v.Elem().Type())
+		data.Elem().Set(v.Elem())
+		cp.Data = data.Interface()
+	}
+	return &cp
+}
+
+// setTpid overwrites a string field named Tpid in the action data, if it has one.
+func (act *Action) setTpid(tpid string) bool {
+	return act.setDataField("Tpid", func(f reflect.Value) bool {
+		if f.Kind() != reflect.String {
+			return false
+		}
+		f.SetString(tpid)
+		return true
+	})
+}
+
+// setDataField finds the named field in the action data and passes it to set, which reports if it could be updated.
+func (act *Action) setDataField(name string, set func(f reflect.Value) bool) bool {
+	if act == nil || act.Data == nil {
+		return false
+	}
+	v := reflect.ValueOf(act.Data)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		f := v.Elem().FieldByName(name)
+		if !f.IsValid() || !f.CanSet() {
+			return false
+		}
+		return set(f)
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	// action data is usually stored by value, so update a copy and replace it
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+	f := cp.FieldByName(name)
+	if !f.IsValid() || !f.CanSet() || !set(f) {
+		return false
+	}
+	act.Data = cp.Interface()
+	return true
+}
+
 // PayTpidRewards is used for wallets "technology provided id" to claim incentive rewards
 type PayTpidRewards struct {
 	Actor eos.AccountName `json:"actor"`
@@ -1,8 +1,12 @@
 package fio
 
 import (
+	"encoding/json"
+	"fmt"
 	"math/rand"
+	"net/http"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -73,3 +77,156 @@ func TestTpid(t *testing.T) {
 		t.Error("expected tpid payout: " + string(j))
 	}
 }
+
+func TestAction_WithNoTpid(t *testing.T) {
+	prev := CurrentTpid()
+	defer SetTpid(prev)
+	SetTpid("tpid@fiotestnet")
+
+	act := NewCancelFndReq("htjonrkf1lgs", 1)
+	if act.Data.(CancelFndReq).Tpid != "tpid@fiotestnet" {
+		t.Fatal("builder did not use the global tpid")
+	}
+	if act.WithNoTpid().Data.(CancelFndReq).Tpid != "" {
+		t.Error("tpid was not cleared")
+	}
+	if CurrentTpid() != "tpid@fiotestnet" {
+		t.Error("global tpid should not change")
+	}
+
+	ptr := &CancelFndReq{Tpid: "tpid@fiotestnet"}
+	act = NewAction("fio.reqobt", "cancelfndreq", "htjonrkf1lgs", ptr)
+	act.WithNoTpid()
+	if ptr.Tpid != "" {
+		t.Error("tpid was not cleared for pointer action data")
+	}
+
+	// no tpid field, should be a no-op
+	act = NewPayTpidRewards("htjonrkf1lgs").WithNoTpid()
+	if act.Data.(PayTpidRewards).Actor != "htjonrkf1lgs" {
+		t.Error("action without tpid was modified")
+	}
+}
+
+func TestAction_WithTpid(t *testing.T) {
+	prev := CurrentTpid()
+	defer SetTpid(prev)
+	SetTpid("global@fiotestnet")
+
+	if _, err := NewCancelFndReq("htjonrkf1lgs", 1).WithTpid("not valid"); err == nil {
+		t.Error("expected error for invalid tpid")
+	}
+	if _, err := NewPayTpidRewards("htjonrkf1lgs").WithTpid("tenant@fiotestnet"); err == nil {
+		t.Error("expected error for action without a tpid")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tpid := fmt.Sprintf("tenant%d@fiotestnet", i)
+			act, err := NewCancelFndReq("htjonrkf1lgs", uint64(i)).WithTpid(tpid)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got := act.Data.(CancelFndReq).Tpid; got != tpid {
+				errs <- fmt.Errorf("expected tpid %s, got %s", tpid, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if CurrentTpid() != "global@fiotestnet" {
+		t.Error("global tpid should not change")
+	}
+}
+
+func TestAPI_SetTpid(t *testing.T) {
+	prev := CurrentTpid()
+	defer SetTpid(prev)
+	SetTpid("global@fiotestnet")
+
+	a, b := &API{}, &API{}
+	if !a.SetTpid("alice@fiotestnet") || !b.SetTpid("bob@fiotestnet") {
+		t.Fatal("valid tpid was rejected")
+	}
+	if a.SetTpid("not valid") || a.Tpid() != "alice@fiotestnet" {
+		t.Error("invalid tpid should be rejected without changing the current one")
+	}
+
+	act := NewRenewDomain("htjonrkf1lgs", "dapixdev")
+	explicit, err := NewRenewDomain("htjonrkf1lgs", "dapixdev").WithTpid("chosen@fiotestnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	none := NewRenewDomain("htjonrkf1lgs", "dapixdev").WithNoTpid()
+
+	outA := a.applyTpid([]*Action{act, explicit, none, NewPayTpidRewards("htjonrkf1lgs")})
+	outB := b.applyTpid([]*Action{act})
+	if outA[0].Data.(RenewDomain).Tpid != "alice@fiotestnet" || outB[0].Data.(RenewDomain).Tpid != "bob@fiotestnet" {
+		t.Error("each API should use its own tpid")
+	}
+	if act.Data.(RenewDomain).Tpid != "global@fiotestnet" {
+		t.Error("caller's action should not be modified")
+	}
+	if outA[1].Data.(RenewDomain).Tpid != "chosen@fiotestnet" || outA[2].Data.(RenewDomain).Tpid != "" {
+		t.Error("WithTpid and WithNoTpid should take precedence over the API tpid")
+	}
+
+	if !a.SetTpid("") || a.Tpid() != "global@fiotestnet" {
+		t.Error("clearing the API tpid should fall back to the global")
+	}
+	if out := a.applyTpid([]*Action{act}); out[0] != act {
+		t.Error("actions should be unchanged without an API tpid")
+	}
+
+	// builders storing a pointer share their data with any copy of the action
+	a.SetTpid("alice@fiotestnet")
+	remAll := NewRemAllNft("alice@fiotestnet", "htjonrkf1lgs")
+	out := a.applyTpid([]*Action{remAll})
+	if out[0].Data.(*RemAllNft).Tpid != "alice@fiotestnet" {
+		t.Error("API tpid was not applied to pointer data")
+	}
+	if remAll.Data.(*RemAllNft).Tpid != "global@fiotestnet" {
+		t.Error("caller's pointer data should not be modified")
+	}
+}
+
+func TestAPI_SetValidatedTpid(t *testing.T) {
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chain/avail_check" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := &AvailCheckReq{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+		if req.FioName == "registered@fiotestnet" {
+			_, _ = w.Write([]byte(`{"is_registered":1}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"is_registered":0}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	if err = api.SetValidatedTpid("registered@fiotestnet"); err != nil || api.Tpid() != "registered@fiotestnet" {
+		t.Errorf("registered tpid should be stored: %v", err)
+	}
+	if err = api.SetValidatedTpid("missing@fiotestnet"); err == nil || !strings.Contains(err.Error(), "not a registered") {
+		t.Errorf("expected an unregistered error, got %v", err)
+	}
+	if err = api.SetValidatedTpid("not valid"); err == nil {
+		t.Error("expected an error for a malformed address")
+	}
+	if api.Tpid() != "registered@fiotestnet" {
+		t.Error("a failed check should not change the tpid")
+	}
+}
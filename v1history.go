@@ -104,6 +104,24 @@ func (api *API) GetMaxActions(account eos.AccountName) (highest uint32, err erro
 	return aa.Actions[len(aa.Actions)-1].AccountActionSequence, nil
 }
 
+// ErrNoHistory is returned by GetActions when the node does not have the history plugin enabled
+var ErrNoHistory = errors.New("history api is not available on this node")
+
+// GetActions fetches the action traces for an account from the v1 history plugin, which must be enabled on the
+// node. A negative pos starts from the most recent action, and offset is the number of actions to return relative
+// to pos: a negative offset returns earlier actions.
+func (api *API) GetActions(account eos.AccountName, pos int64, offset int64) (*eos.ActionsResp, error) {
+	resp := &eos.ActionsResp{}
+	err := api.call("history", "get_actions", eos.GetActionsRequest{AccountName: account, Pos: pos, Offset: offset}, resp)
+	if IsNotFound(err) {
+		return nil, ErrNoHistory
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 // HasHistory looks at available APIs and returns true if /v1/history/* exists.
 func (api *API) HasHistory() bool {
 	_, apis, err := api.GetSupportedApis()
@@ -125,7 +143,7 @@ func (api *API) HasHistory() bool {
 // Deprecated: a new endpoint that handles de-duplication will make this function irrelevant.
 func (api *API) GetActionsUniq(actor eos.AccountName, offset int64, pos int64) ([]*eos.ActionTrace, error) {
 	traceUniq := make(map[string]*eos.ActionTrace)
-	resp, err := api.GetActions(eos.GetActionsRequest{AccountName: actor, Offset: offset, Pos: pos})
+	resp, err := api.GetActions(actor, pos, offset)
 	if err != nil {
 		return nil, err
 	}
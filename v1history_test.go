@@ -1,7 +1,10 @@
 package fio
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/fioprotocol/fio-go/eos"
+	"net/http"
 	"testing"
 )
 
@@ -76,3 +79,44 @@ func TestAPI_GetActionsUniq(t *testing.T) {
 		seen[trace.Receipt.ActionDigest] = true
 	}
 }
+
+func TestAPI_GetActions(t *testing.T) {
+	history := true
+	var got eos.GetActionsRequest
+	_, api, srv, err := newMockApi(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/history/get_actions" || !history {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":404,"message":"Not Found","error":{"code":0,"name":"exception","what":"unknown","details":[{"message":"Unknown Endpoint","file":"http_plugin.cpp","line_number":0,"method":"handle_http_request"}]}}`))
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"actions":[{"global_action_seq":10,"account_action_seq":1,"block_num":5,"block_time":"2021-01-01T00:00:00.000",
+			"action_trace":{"receipt":{"receiver":"fio.token","act_digest":"ab","global_sequence":10,"recv_sequence":1,"auth_sequence":[],"code_sequence":1,"abi_sequence":1},
+			"act":{"account":"fio.token","name":"trnsfiopubky","authorization":[{"actor":"htjonrkf1lgs","permission":"active"}],
+			"data":{"payee_public_key":"FIO6LKbc","amount":1000000000,"max_fee":0,"actor":"htjonrkf1lgs","tpid":""}}}}],"last_irreversible_block":5}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	resp, err := api.GetActions("htjonrkf1lgs", -1, -10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AccountName != "htjonrkf1lgs" || got.Pos != -1 || got.Offset != -10 {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	if len(resp.Actions) != 1 || resp.Actions[0].BlockNum != 5 || resp.Actions[0].Trace.Action.Name != "trnsfiopubky" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	data, ok := resp.Actions[0].Trace.Action.Data.(map[string]interface{})
+	if !ok || data["payee_public_key"] != "FIO6LKbc" {
+		t.Errorf("action data was not decoded: %+v", resp.Actions[0].Trace.Action.Data)
+	}
+
+	history = false
+	if _, err = api.GetActions("htjonrkf1lgs", -1, -10); err != ErrNoHistory {
+		t.Errorf("expected ErrNoHistory, got %v", err)
+	}
+}